@@ -27,7 +27,7 @@ for M in "${MAPPERS_LIST[@]}"; do
         && mv tmp.json "$CONFIG_PATH"
 
       # Pulizia file locali
-      sudo rm -f ./output/*
+      sudo rm -rf ./output/*
       sudo rm -f ./state/completed.json
 
       START=$(date +%s)
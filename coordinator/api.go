@@ -0,0 +1,429 @@
+package coordinator
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ========================================================================================
+// API HTTP: invio dei job, stato di avanzamento, worker, annullamento e download dell'output
+// ========================================================================================
+
+// Indirizzo di ascolto dell'API se settings.api.address non è indicato
+const defaultAPIAddress = ":8080"
+
+// Valori generati al più da un job inviato all'API se settings.api.maxCount non è indicato
+const defaultAPIMaxCount = 10000000
+
+// Restituito dalle fasi del job quando il job viene annullato dall'API
+var errJobCanceled = errors.New("job annullato")
+
+// Genera l'ID di un job
+func newJobID() string {
+	return fmt.Sprintf("job-%x", time.Now().UnixNano())
+}
+
+// Stato del job per l'API
+func (m *Master) jobStatus(job *Job) utils.JobStatus {
+	m.jobMu.Lock()
+	status := utils.JobStatus{JobInfo: job.info, State: job.state, Error: job.err, Phase: "done"}
+	if !job.started.IsZero() {
+		started := job.started
+		status.Started = &started
+	}
+	running := false
+	switch job.state {
+	case utils.JobQueued:
+		status.Phase = utils.JobQueued
+		status.QueuePosition = m.queuePositionLocked(job)
+		status.Scheduling = &utils.SchedulingStatus{Policy: m.scheduler.policy, Priority: job.Settings.Priority, Weight: jobWeight(job.Settings)}
+	case utils.JobRunning:
+		running = true
+		status.Scheduling = m.scheduler.status(job.share)
+	default:
+		finished := job.finished
+		status.Finished = &finished
+		status.Chunks, status.Partitions = job.chunks, job.partitions
+		status.Scheduling = job.scheduling
+	}
+	m.jobMu.Unlock()
+
+	if running {
+		status.Chunks, status.Partitions, status.Phase = job.progress()
+	}
+	for _, c := range status.Chunks {
+		if c.State == utils.TaskDone {
+			status.ChunksDone++
+		}
+	}
+	for _, p := range status.Partitions {
+		if p.State == utils.TaskDone {
+			status.PartitionsDone++
+		}
+	}
+	return status
+}
+
+// Avvia il server HTTP dell'API
+func (m *Master) ServeAPI() {
+	addr := defaultAPIAddress
+	if m.defaults.API != nil && m.defaults.API.Address != "" {
+		addr = m.defaults.API.Address
+	}
+
+	log.Printf("API HTTP in ascolto su %s\n", addr)
+	if err := http.ListenAndServe(addr, m.apiHandler()); err != nil {
+		log.Fatalf("Errore nell'ascolto dell'API HTTP su %s: %v", addr, err)
+	}
+}
+
+// Handler dell'API: con un token configurato ogni richiesta deve presentarlo
+func (m *Master) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", m.handleSubmit)
+	mux.HandleFunc("GET /jobs", m.handleListJobs)
+	mux.HandleFunc("GET /jobs/{id}", m.handleJobStatus)
+	mux.HandleFunc("DELETE /jobs/{id}", m.handleCancel)
+	mux.HandleFunc("GET /jobs/{id}/failures", m.handleFailures)
+	mux.HandleFunc("GET /jobs/{id}/output", m.handleOutputList)
+	mux.HandleFunc("GET /jobs/{id}/output/{file...}", m.handleOutputFile)
+	mux.HandleFunc("GET /workers", m.handleWorkers)
+
+	token := m.apiToken()
+	if token == "" {
+		log.Println("[API] Nessun token configurato: l'API va esposta solo in locale o su una rete fidata")
+		return mux
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "token dell'API mancante o non valido")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Token dell'API: API_TOKEN, altrimenti settings.api.token ("" = nessuna autenticazione)
+func (m *Master) apiToken() string {
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		return token
+	}
+	if m.defaults.API != nil {
+		return m.defaults.API.Token
+	}
+	return ""
+}
+
+// Scrive una risposta JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Scrive una risposta di errore
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	writeJSON(w, code, utils.APIError{Error: fmt.Sprintf(format, args...)})
+}
+
+// Impostazioni di un job inviato all'API: i campi assenti valgono come in config.json,
+// mentre numero di worker, heartbeat, API, coda dei job e scheduler restano quelli del cluster
+func (m *Master) jobSettings(body io.Reader) (utils.Settings, error) {
+	var settings utils.Settings
+	base, err := json.Marshal(m.defaults)
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(base, &settings); err != nil {
+		return settings, err
+	}
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil && err != io.EOF {
+		return settings, err
+	}
+	settings.NumMappers = m.defaults.NumMappers
+	settings.NumReducers = m.defaults.NumReducers
+	settings.Heartbeat = m.defaults.Heartbeat
+	settings.API = m.defaults.API
+	settings.Jobs = m.defaults.Jobs
+	settings.Scheduler = m.defaults.Scheduler
+	return settings, nil
+}
+
+// I job inviati all'API leggono solo dalla cartella api.inputRoot: input.path e il download
+// dell'output altrimenti permetterebbero di leggere qualunque file del master. Resta ammesso
+// il percorso di config.json, scelto da chi amministra il cluster. L'output è sempre in output/jobs/<id>.
+func (m *Master) checkInputPath(settings utils.Settings) error {
+	if settings.Input == nil || settings.Input.Path == "" {
+		return nil
+	}
+	if m.defaults.Input != nil && settings.Input.Path == m.defaults.Input.Path {
+		return nil
+	}
+	root := "input"
+	if m.defaults.API != nil && m.defaults.API.InputRoot != "" {
+		root = m.defaults.API.InputRoot
+	}
+	return settings.Input.CheckRoot(root)
+}
+
+// Limita i valori generati da un job inviato all'API: il master pianifica e i worker generano
+// l'intero dataset. Il count di config.json resta ammesso anche se supera il limite.
+func (m *Master) checkCount(settings utils.Settings) error {
+	limit := defaultAPIMaxCount
+	if m.defaults.API != nil && m.defaults.API.MaxCount > 0 {
+		limit = m.defaults.API.MaxCount
+	}
+	if m.defaults.Count > limit {
+		limit = m.defaults.Count
+	}
+	if settings.Count < 0 || settings.Count > limit {
+		return fmt.Errorf("count %d fuori da [0, %d] (api.maxCount)", settings.Count, limit)
+	}
+	return nil
+}
+
+// POST /jobs: mette in coda un job con le impostazioni del corpo (oggetto "settings" di config.json)
+func (m *Master) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	settings, err := m.jobSettings(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "impostazioni non valide: %v", err)
+		return
+	}
+	if err := validateSettings(settings); err != nil {
+		writeError(w, http.StatusBadRequest, "impostazioni non valide: %v", err)
+		return
+	}
+	if err := m.checkInputPath(settings); err != nil {
+		writeError(w, http.StatusBadRequest, "impostazioni non valide: %v", err)
+		return
+	}
+	if err := m.checkCount(settings); err != nil {
+		writeError(w, http.StatusBadRequest, "impostazioni non valide: %v", err)
+		return
+	}
+
+	job, err := m.submit(utils.JobInfo{ID: newJobID(), Settings: settings, Submitted: time.Now(), API: true})
+	if errors.Is(err, errQueueFull) {
+		writeError(w, http.StatusServiceUnavailable, "%v: riprovare più tardi", err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "salvataggio del job: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, m.jobStatus(job))
+}
+
+// Job indicato nel percorso; se non esiste risponde 404 e restituisce nil
+func (m *Master) lookupJob(w http.ResponseWriter, r *http.Request) *Job {
+	id := r.PathValue("id")
+	m.jobMu.Lock()
+	job := m.jobs[id]
+	m.jobMu.Unlock()
+	if job == nil {
+		writeError(w, http.StatusNotFound, "job %s non trovato", id)
+		return nil
+	}
+	return job
+}
+
+// GET /jobs: job in coda, in esecuzione e conclusi, in ordine di invio
+func (m *Master) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	m.jobMu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.jobMu.Unlock()
+	sort.Slice(jobs, func(a, b int) bool {
+		if !jobs[a].info.Submitted.Equal(jobs[b].info.Submitted) {
+			return jobs[a].info.Submitted.Before(jobs[b].info.Submitted)
+		}
+		return jobs[a].info.ID < jobs[b].info.ID
+	})
+
+	statuses := make([]utils.JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		statuses = append(statuses, m.jobStatus(job))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// GET /jobs/{id}: stato e avanzamento per chunk e per partizione
+func (m *Master) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	if job := m.lookupJob(w, r); job != nil {
+		writeJSON(w, http.StatusOK, m.jobStatus(job))
+	}
+}
+
+// DELETE /jobs/{id}: annulla il job. Un job in coda non viene avviato; per un job in esecuzione
+// i tentativi in corso vengono abbandonati e stato e output parziale cancellati
+func (m *Master) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job := m.lookupJob(w, r)
+	if job == nil {
+		return
+	}
+	m.jobMu.Lock()
+	state := job.state
+	if state == utils.JobQueued {
+		m.cancelQueuedLocked(job)
+	}
+	m.jobMu.Unlock()
+	switch state {
+	case utils.JobQueued:
+	case utils.JobRunning:
+		job.once.Do(func() {
+			log.Printf("[JOB] Annullamento del job %s richiesto dall'API\n", job.info.ID)
+			close(job.cancel)
+		})
+	default:
+		writeError(w, http.StatusConflict, "job %s già concluso", job.info.ID)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, m.jobStatus(job))
+}
+
+// GET /jobs/{id}/failures?since=N: fallimenti dei task successivi all'N-esimo
+func (m *Master) handleFailures(w http.ResponseWriter, r *http.Request) {
+	job := m.lookupJob(w, r)
+	if job == nil {
+		return
+	}
+	since := 0
+	if value := r.URL.Query().Get("since"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "since non valido: %q", value)
+			return
+		}
+		since = n
+	}
+
+	m.jobMu.Lock()
+	failures := []utils.TaskFailure{}
+	if since < len(job.failures) {
+		failures = append(failures, job.failures[since:]...)
+	}
+	m.jobMu.Unlock()
+	writeJSON(w, http.StatusOK, failures)
+}
+
+// File dell'output finale del job, con percorso relativo alla cartella dell'output del job
+func outputEntries(dir string) ([]utils.OutputEntry, error) {
+	var entries []utils.OutputEntry
+	add := func(path string) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sum := sha256.New()
+		size, err := io.Copy(sum, file)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, path)
+		entries = append(entries, utils.OutputEntry{Name: filepath.ToSlash(name), Size: size, Checksum: hex.EncodeToString(sum.Sum(nil))})
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "final_output*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if err := add(path); err != nil {
+			return nil, err
+		}
+	}
+	err = filepath.WalkDir(filepath.Join(dir, "final"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return add(path)
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Verifica che l'output del job sia disponibile (job completato); altrimenti risponde 409
+func (m *Master) outputReady(w http.ResponseWriter, job *Job) bool {
+	m.jobMu.Lock()
+	state := job.state
+	m.jobMu.Unlock()
+	if state != utils.JobCompleted {
+		writeError(w, http.StatusConflict, "output del job %s non disponibile: job %s", job.info.ID, state)
+		return false
+	}
+	return true
+}
+
+// GET /jobs/{id}/output: elenco dei file dell'output finale
+func (m *Master) handleOutputList(w http.ResponseWriter, r *http.Request) {
+	job := m.lookupJob(w, r)
+	if job == nil || !m.outputReady(w, job) {
+		return
+	}
+	entries, err := outputEntries(job.outDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "lettura dell'output: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// GET /jobs/{id}/output/{file}: download di un file dell'output finale
+func (m *Master) handleOutputFile(w http.ResponseWriter, r *http.Request) {
+	job := m.lookupJob(w, r)
+	if job == nil || !m.outputReady(w, job) {
+		return
+	}
+	entries, err := outputEntries(job.outDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "lettura dell'output: %v", err)
+		return
+	}
+
+	// Solo i file elencati: il nome non può uscire dalla cartella di output
+	name := r.PathValue("file")
+	for _, entry := range entries {
+		if entry.Name == name {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(name)))
+			http.ServeFile(w, r, filepath.Join(job.outDir, filepath.FromSlash(name)))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "file %s non presente nell'output del job %s", name, job.info.ID)
+}
+
+// GET /workers: worker registrati e stato secondo gli heartbeat
+func (m *Master) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	workers := m.registeredWorkers()
+
+	statuses := make([]utils.WorkerStatus, 0, len(workers))
+	for _, worker := range workers {
+		statuses = append(statuses, utils.WorkerStatus{Address: worker.Address, Role: worker.Role, State: m.liveness.State(worker.Address)})
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
@@ -0,0 +1,81 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sdcc-mapreduce/utils"
+	"strings"
+	"testing"
+)
+
+// Esegue una richiesta sull'handler dell'API con il token indicato ("" = nessun token)
+func apiRequest(m *Master, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	m.apiHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+// Con un token configurato ogni endpoint lo richiede
+func TestAPIRequiresToken(t *testing.T) {
+	t.Setenv("API_TOKEN", "")
+	m := servingMaster()
+	m.defaults.API.Token = "s3greto"
+
+	for _, token := range []string{"", "altro"} {
+		if rec := apiRequest(m, http.MethodGet, "/workers", "", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: risposta %d, attesa 401", token, rec.Code)
+		}
+		if rec := apiRequest(m, http.MethodPost, "/jobs", "{}", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("invio con token %q: risposta %d, attesa 401", token, rec.Code)
+		}
+	}
+	if rec := apiRequest(m, http.MethodGet, "/workers", "", "s3greto"); rec.Code != http.StatusOK {
+		t.Errorf("token valido: risposta %d %s", rec.Code, rec.Body)
+	}
+
+	// API_TOKEN prevale su api.token
+	t.Setenv("API_TOKEN", "da-env")
+	if rec := apiRequest(m, http.MethodGet, "/workers", "", "da-env"); rec.Code != http.StatusOK {
+		t.Errorf("token da API_TOKEN: risposta %d", rec.Code)
+	}
+}
+
+// Un job inviato all'API non può generare più di api.maxCount valori
+func TestAPIRejectsLargeCount(t *testing.T) {
+	t.Setenv("API_TOKEN", "")
+	m := servingMaster()
+	m.defaults.JobType, m.defaults.KeyType, m.defaults.Count = "sort", "int", 100
+	m.defaults.API.MaxCount = 1000
+
+	for _, body := range []string{`{"count": 1001}`, `{"count": -1}`} {
+		rec := apiRequest(m, http.MethodPost, "/jobs", body, "")
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "maxCount") {
+			t.Errorf("%s: risposta %d %s, attesa 400", body, rec.Code, rec.Body)
+		}
+	}
+	if err := m.checkCount(utils.Settings{Count: 1000}); err != nil {
+		t.Errorf("count al limite rifiutato: %v", err)
+	}
+	// Il count di config.json resta ammesso
+	m.defaults.Count = 5000
+	if err := m.checkCount(utils.Settings{Count: 5000}); err != nil {
+		t.Errorf("count di config.json rifiutato: %v", err)
+	}
+}
+
+// Anche senza api.serve un job inviato all'API che fallisce non arresta il master
+func TestAPIJobErrorDoesNotStopMaster(t *testing.T) {
+	store := testStore(t)
+	if err := store.Put("state/jobs/j1/status.json", []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	m := &Master{liveness: NewLiveness(nil)}
+	job := m.newJob(utils.JobInfo{ID: "j1", Settings: utils.Settings{JobType: "sort", KeyType: "int"}, API: true})
+	if err := runJob(job); err == nil {
+		t.Error("job con status.json corrotto eseguito")
+	}
+}
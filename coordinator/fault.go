@@ -1,6 +1,7 @@
-package main
+package coordinator
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,7 +11,10 @@ import (
 	"sdcc-mapreduce/utils"
 )
 
-// Tenta di inviare una RPC a uno dei mapper disponibili
+// Tenta di inviare una RPC a uno dei mapper disponibili, occupando uno slot del mapper
+// assegnato dallo scheduler al job (share) per tutta la durata della chiamata.
+// Se cancel viene chiuso (es. il chunk è stato completato da un altro tentativo) rinuncia subito.
+// dispatched, se non nil, viene chiamata con l'indirizzo del mapper a ogni invio.
 func CallWithFallbackMapBusy(
 	workers []utils.WorkerConfig,
 	method string,
@@ -18,7 +22,10 @@ func CallWithFallbackMapBusy(
 	reply interface{},
 	logPrefix string,
 	taskLabel string,
-	busy *utils.ThreadSafeMap,
+	share *jobShare,
+	liveness *Liveness,
+	cancel <-chan struct{},
+	dispatched func(addr string),
 ) error {
 	const maxRetries = 5
 	const retryDelay = 2 * time.Second
@@ -32,37 +39,64 @@ func CallWithFallbackMapBusy(
 	for retry := 1; retry <= maxRetries; retry++ {
 		tried := make(map[string]bool)
 
-		for _, worker := range workers {
-			addr := worker.Address
+		select {
+		case <-cancel:
+			return fmt.Errorf("%s annullato", taskLabel)
+		default:
+		}
 
-			if tried[addr] || busy.Get(addr) {
-				continue
+		for {
+			// Attende uno slot su un mapper vivo non ancora provato in questo giro
+			addr, err := share.acquire("mapper", workers, tried, cancel)
+			if errors.Is(err, errNoSlot) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s annullato", taskLabel)
 			}
 
 			tried[addr] = true
 			attempts++
-			busy.Set(addr, true)
 
 			conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
 			if err != nil {
 				logger.Printf("[%s] Tentativo %d: connessione fallita a %s: %v", logPrefix, attempts, addr, err)
-				busy.Set(addr, false)
+				share.release("mapper", addr)
 				continue
 			}
 
+			// Chiamata asincrona: se il mapper viene dichiarato morto durante il task
+			// il chunk viene riassegnato subito, senza attendere la risposta
 			client := rpc.NewClient(conn)
-			err = client.Call(method, request, reply)
+			call := client.Go(method, request, reply, make(chan *rpc.Call, 1))
+			if dispatched != nil {
+				dispatched(addr)
+			}
+			select {
+			case <-call.Done:
+				err = call.Error
+			case <-liveness.DeadChan(addr):
+				err = fmt.Errorf("mapper %s dichiarato morto durante il task", addr)
+				// Chiude la connessione e attende che la chiamata termini prima di riusare reply
+				client.Close()
+				<-call.Done
+			case <-cancel:
+				client.Close()
+				<-call.Done
+				share.release("mapper", addr)
+				logger.Printf("[%s] Annullato mentre era in esecuzione su %s", logPrefix, addr)
+				return fmt.Errorf("%s annullato", taskLabel)
+			}
 			client.Close()
+			share.release("mapper", addr)
 
 			if err != nil {
 				logger.Printf("[%s] Tentativo %d: errore RPC su %s: %v", logPrefix, attempts, addr, err)
-				busy.Set(addr, false)
 				continue
 			}
 
 			// Se la risposta è valida → successo
 			if mapReply, ok := reply.(*utils.MapReply); ok && mapReply.Ack {
-				busy.Set(addr, false)
 				logger.Printf("[%s] Completato con successo da %s", logPrefix, addr)
 				return nil
 			}
@@ -0,0 +1,189 @@
+package coordinator
+
+import (
+	"log"
+	"sdcc-mapreduce/utils"
+	"sync"
+	"time"
+)
+
+// ========================================================================================
+// Liveness dei worker tramite heartbeat
+// ========================================================================================
+
+// Stati di un worker secondo gli heartbeat ricevuti
+const (
+	WorkerAlive   = "alive"
+	WorkerSuspect = "suspect"
+	WorkerDead    = "dead"
+)
+
+// Timeout di default se non specificati in settings.heartbeat
+const (
+	defaultHeartbeatInterval = 1 * time.Second
+	defaultSuspectAfter      = 3 * time.Second
+	defaultDeadAfter         = 6 * time.Second
+)
+
+// Liveness tiene traccia dell'ultimo heartbeat di ogni worker e del suo stato
+type Liveness struct {
+	mu           sync.Mutex
+	lastSeen     map[string]time.Time
+	states       map[string]string
+	deadCh       map[string]chan struct{} // Chiuso quando il worker viene dichiarato morto
+	interval     time.Duration
+	suspectAfter time.Duration
+	deadAfter    time.Duration
+}
+
+// Crea il tracker con i timeout configurati (quelli a zero prendono il valore di default)
+func NewLiveness(cfg *utils.HeartbeatConfig) *Liveness {
+	l := &Liveness{
+		lastSeen:     make(map[string]time.Time),
+		states:       make(map[string]string),
+		deadCh:       make(map[string]chan struct{}),
+		interval:     defaultHeartbeatInterval,
+		suspectAfter: defaultSuspectAfter,
+		deadAfter:    defaultDeadAfter,
+	}
+	if cfg != nil {
+		if cfg.IntervalMs > 0 {
+			l.interval = time.Duration(cfg.IntervalMs) * time.Millisecond
+		}
+		if cfg.SuspectAfterMs > 0 {
+			l.suspectAfter = time.Duration(cfg.SuspectAfterMs) * time.Millisecond
+		}
+		if cfg.DeadAfterMs > 0 {
+			l.deadAfter = time.Duration(cfg.DeadAfterMs) * time.Millisecond
+		}
+	}
+	if l.deadAfter < l.suspectAfter {
+		l.deadAfter = l.suspectAfter
+	}
+	return l
+}
+
+// Registra un heartbeat (o una registrazione) del worker
+func (l *Liveness) Beat(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastSeen[addr] = time.Now()
+	if prev := l.states[addr]; prev != WorkerAlive {
+		if prev != "" {
+			log.Printf("[HEARTBEAT] Worker %s: %s → %s\n", addr, prev, WorkerAlive)
+		}
+		l.states[addr] = WorkerAlive
+	}
+	// Un worker tornato in vita riceve un nuovo canale di morte
+	if ch, ok := l.deadCh[addr]; ok {
+		select {
+		case <-ch:
+			delete(l.deadCh, addr)
+		default:
+		}
+	}
+}
+
+// Stato corrente del worker; un worker mai visto è considerato vivo
+func (l *Liveness) State(addr string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state, ok := l.states[addr]; ok {
+		return state
+	}
+	return WorkerAlive
+}
+
+// Indica se il worker è stato dichiarato morto
+func (l *Liveness) IsDead(addr string) bool {
+	return l.State(addr) == WorkerDead
+}
+
+// Restituisce un canale che viene chiuso quando il worker viene dichiarato morto
+func (l *Liveness) DeadChan(addr string) <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.deadCh[addr]
+	if !ok {
+		ch = make(chan struct{})
+		if l.states[addr] == WorkerDead {
+			close(ch)
+		}
+		l.deadCh[addr] = ch
+	}
+	return ch
+}
+
+// Copia dello stato di tutti i worker conosciuti
+func (l *Liveness) Snapshot() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[string]string, len(l.states))
+	for addr, state := range l.states {
+		snapshot[addr] = state
+	}
+	return snapshot
+}
+
+// Ricalcola periodicamente lo stato dei worker in base all'ultimo heartbeat
+func (l *Liveness) Monitor() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.evaluate(time.Now())
+	}
+}
+
+// Applica le transizioni alive → suspect → dead
+func (l *Liveness) evaluate(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for addr, seen := range l.lastSeen {
+		state := WorkerAlive
+		switch elapsed := now.Sub(seen); {
+		case elapsed >= l.deadAfter:
+			state = WorkerDead
+		case elapsed >= l.suspectAfter:
+			state = WorkerSuspect
+		}
+
+		prev := l.states[addr]
+		if state == prev {
+			continue
+		}
+		log.Printf("[HEARTBEAT] Worker %s: %s → %s (ultimo heartbeat %v fa)\n", addr, prev, state, now.Sub(seen).Round(time.Millisecond))
+		l.states[addr] = state
+
+		if state == WorkerDead {
+			if ch, ok := l.deadCh[addr]; ok {
+				close(ch)
+			} else {
+				ch = make(chan struct{})
+				close(ch)
+				l.deadCh[addr] = ch
+			}
+		}
+	}
+}
+
+// Metodo RPC chiamato periodicamente dai worker
+func (m *Master) Heartbeat(req utils.HeartbeatRequest, reply *utils.HeartbeatReply) error {
+	m.liveness.Beat(req.Address)
+
+	// Se il master non conosce il worker (es. riavvio senza workers.json) gli chiede di registrarsi di nuovo
+	m.mu.Lock()
+	known := false
+	for _, w := range m.Workers {
+		if w.Address == req.Address {
+			known = true
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	reply.Registered = known
+	reply.IntervalMs = int(m.liveness.interval / time.Millisecond)
+	return nil
+}
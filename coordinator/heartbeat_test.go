@@ -0,0 +1,169 @@
+package coordinator
+
+import (
+	"net"
+	"net/rpc"
+	"sdcc-mapreduce/utils"
+	"testing"
+	"time"
+)
+
+// Indica se il canale è chiuso
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Transizioni alive → suspect → dead secondo il tempo dall'ultimo heartbeat (orologio del test)
+func TestLivenessTransitions(t *testing.T) {
+	l := NewLiveness(&utils.HeartbeatConfig{SuspectAfterMs: 3000, DeadAfterMs: 6000})
+	addr := "mapper:9001"
+	l.Beat(addr)
+	start := l.lastSeen[addr]
+	deadCh := l.DeadChan(addr)
+
+	steps := []struct {
+		after time.Duration
+		state string
+	}{
+		{time.Second, WorkerAlive},
+		{3 * time.Second, WorkerSuspect},
+		{5 * time.Second, WorkerSuspect},
+		{6 * time.Second, WorkerDead},
+		{time.Minute, WorkerDead},
+	}
+	for _, s := range steps {
+		l.evaluate(start.Add(s.after))
+		if got := l.State(addr); got != s.state {
+			t.Errorf("dopo %v: stato %s, atteso %s", s.after, got, s.state)
+		}
+		if closed(deadCh) != (s.state == WorkerDead) {
+			t.Errorf("dopo %v: canale di morte chiuso = %v", s.after, closed(deadCh))
+		}
+	}
+	if !l.IsDead(addr) || !closed(l.DeadChan(addr)) {
+		t.Error("canale richiesto dopo la morte non chiuso")
+	}
+
+	// Un heartbeat riporta in vita il worker con un nuovo canale di morte
+	l.Beat(addr)
+	if l.State(addr) != WorkerAlive {
+		t.Errorf("stato dopo l'heartbeat: %s", l.State(addr))
+	}
+	again := l.DeadChan(addr)
+	if closed(again) {
+		t.Fatal("nuovo canale di morte già chiuso")
+	}
+	l.evaluate(l.lastSeen[addr].Add(6 * time.Second))
+	if !closed(again) {
+		t.Error("seconda morte non segnalata")
+	}
+
+	// Un worker mai visto è vivo
+	if l.State("sconosciuto:9001") != WorkerAlive {
+		t.Error("worker mai visto non considerato vivo")
+	}
+}
+
+// Un worker sconosciuto al master (es. riavvio senza workers.json) viene invitato a registrarsi di nuovo
+func TestHeartbeatAsksUnknownWorkerToRegister(t *testing.T) {
+	m := &Master{liveness: NewLiveness(&utils.HeartbeatConfig{IntervalMs: 500})}
+	worker := utils.WorkerConfig{Role: "mapper", Address: "mapper:9001"}
+
+	cases := []struct {
+		register   bool
+		registered bool
+	}{
+		{false, false},
+		{true, true},
+		{false, true},
+	}
+	for i, c := range cases {
+		if c.register {
+			var ok bool
+			if err := m.Register(worker, &ok); err != nil || !ok {
+				t.Fatalf("passo %d: registrazione %v, %v", i, ok, err)
+			}
+		}
+		var reply utils.HeartbeatReply
+		if err := m.Heartbeat(utils.HeartbeatRequest{Address: worker.Address}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.Registered != c.registered || reply.IntervalMs != 500 {
+			t.Errorf("passo %d: risposta %+v, Registered atteso %v", i, reply, c.registered)
+		}
+	}
+
+	var ok bool
+	m.Register(worker, &ok)
+	if ok {
+		t.Error("registrazione duplicata accettata")
+	}
+}
+
+// Mapper finto che completa ogni task
+type fakeMapper struct{}
+
+func (fakeMapper) MapTask(req utils.MapRequest, reply *utils.MapReply) error {
+	reply.Ack = true
+	return nil
+}
+
+// Un mapper dichiarato morto durante il task viene abbandonato e il chunk passa a un altro mapper
+func TestDeadMapperTaskReassigned(t *testing.T) {
+	hung, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	go func() {
+		for {
+			conn, err := hung.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	alive, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alive.Close()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Worker", fakeMapper{}); err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(alive)
+
+	liveness := NewLiveness(nil)
+	liveness.Beat(hung.Addr().String())
+	sched := NewScheduler(nil, liveness)
+	share := sched.register(utils.JobInfo{ID: "job"})
+	workers := mappers(hung.Addr().String(), alive.Addr().String())
+
+	var sent []string
+	dispatched := func(addr string) {
+		sent = append(sent, addr)
+		if addr == hung.Addr().String() {
+			// Heartbeat assenti oltre deadAfter
+			go liveness.evaluate(time.Now().Add(time.Minute))
+		}
+	}
+	reply := utils.MapReply{}
+	err = CallWithFallbackMapBusy(workers, "Worker.MapTask", utils.MapRequest{}, &reply, "TEST", "chunk 0", share, liveness, nil, dispatched)
+	if err != nil || !reply.Ack {
+		t.Fatalf("task non completato: %v, %+v", err, reply)
+	}
+	if len(sent) != 2 || sent[0] != hung.Addr().String() || sent[1] != alive.Addr().String() {
+		t.Errorf("invii %v, attesi il mapper bloccato e poi quello vivo", sent)
+	}
+	if got := sched.status(share); got.MapSlots != 0 {
+		t.Errorf("%d slot ancora occupati", got.MapSlots)
+	}
+}
@@ -0,0 +1,399 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ========================================================================================
+// Coda dei job: più job sugli stessi worker, ciascuno con il proprio stato e il proprio output
+// ========================================================================================
+
+// Valori di default di settings.jobs
+const (
+	defaultMaxConcurrentJobs = 1
+	defaultMaxQueuedJobs     = 100
+	defaultJobHistory        = 20
+)
+
+// Restituito all'invio di un job quando la coda è piena
+var errQueueFull = errors.New("coda dei job piena")
+
+// Job è un job gestito dal master: in coda, in esecuzione o concluso.
+// Condivide con gli altri job i worker del master; stato e output sono separati per ID:
+// state/jobs/<id>/ nello store, output/jobs/<id>/ sul disco del master, jobs/<id>/ sui worker.
+type Job struct {
+	*Master
+	Settings utils.Settings // Parametri del job
+	keys     utils.KeyType  // Tipo delle chiavi, risolto all'avvio da runJob
+	info     utils.JobInfo
+	store    *utils.JobState // Stato del job nello store
+	outDir   string          // Cartella dell'output del job
+	share    *jobShare       // Parte del job nello scheduler, durante l'esecuzione
+
+	partMu       sync.Mutex          // per accesso concorrente al partizionamento
+	partition    utils.PartitionSpec // Partizionamento del job, con le partizioni riassegnate
+	lostReducers map[string]bool     // Reducer persi durante il job: non ricevono più partizioni
+
+	// Ciclo di vita del job, protetto da Master.jobMu
+	state    string
+	err      string
+	started  time.Time
+	finished time.Time
+	cancel   chan struct{} // Chiuso quando il job viene annullato
+	once     sync.Once
+
+	// Avanzamento al termine del job (lo stato dei task viene poi cancellato)
+	chunks     []utils.ChunkProgress
+	partitions []utils.PartitionProgress
+	scheduling *utils.SchedulingStatus // Statistiche finali dello scheduler
+
+	failures []utils.TaskFailure // Fallimenti dei task, in ordine (solo in memoria)
+}
+
+// Crea un job in coda
+func (m *Master) newJob(info utils.JobInfo) *Job {
+	return &Job{
+		Master:   m,
+		Settings: info.Settings,
+		info:     info,
+		store:    utils.NewJobState(info.ID),
+		outDir:   utils.JobOutputDir(info.ID),
+		state:    utils.JobQueued,
+		cancel:   make(chan struct{}),
+	}
+}
+
+// Indica se il master esegue solo i job inviati all'API (settings.api.serve)
+func (m *Master) serving() bool {
+	return m.defaults.API != nil && m.defaults.API.Serve
+}
+
+// Limiti della coda secondo settings.jobs
+func (m *Master) jobLimits() (maxConcurrent, maxQueued, history int) {
+	maxConcurrent, maxQueued, history = defaultMaxConcurrentJobs, defaultMaxQueuedJobs, defaultJobHistory
+	if cfg := m.defaults.Jobs; cfg != nil {
+		if cfg.MaxConcurrent > 0 {
+			maxConcurrent = cfg.MaxConcurrent
+		}
+		if cfg.MaxQueued > 0 {
+			maxQueued = cfg.MaxQueued
+		}
+		if cfg.History > 0 {
+			history = cfg.History
+		}
+	}
+	return
+}
+
+// Accoda un nuovo job dopo averlo salvato in job.json, così da riprenderlo dopo un crash del master.
+// Restituisce errQueueFull se i job in attesa sono già settings.jobs.maxQueued.
+func (m *Master) submit(info utils.JobInfo) (*Job, error) {
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+
+	if _, maxQueued, _ := m.jobLimits(); len(m.queue) >= maxQueued {
+		return nil, errQueueFull
+	}
+	job := m.newJob(info)
+	if err := job.store.SaveJobInfo(info); err != nil {
+		return nil, err
+	}
+	m.enqueueLocked(job)
+	return job, nil
+}
+
+// Mette il job in coda e avvia i job che rientrano nel limite di concorrenza (con jobMu acquisito).
+// Salvo con la politica fifo, il job passa davanti ai job in attesa con priorità più bassa.
+func (m *Master) enqueueLocked(job *Job) {
+	m.jobs[job.info.ID] = job
+	pos := len(m.queue)
+	if m.scheduler.policy != utils.FIFOScheduling {
+		for pos > 0 && m.queue[pos-1].Settings.Priority < job.Settings.Priority {
+			pos--
+		}
+	}
+	m.queue = append(m.queue, nil)
+	copy(m.queue[pos+1:], m.queue[pos:])
+	m.queue[pos] = job
+	log.Printf("[JOB] Job %s in coda (job %q, %d valori, priorità %d, posizione %d)\n", job.info.ID, job.Settings.JobType, job.Settings.Count, job.Settings.Priority, pos+1)
+	m.dispatchLocked()
+}
+
+// Avvia i job in attesa, in ordine di coda, finché i job in esecuzione sono meno di settings.jobs.maxConcurrent
+func (m *Master) dispatchLocked() {
+	maxConcurrent, _, _ := m.jobLimits()
+	for m.running < maxConcurrent && len(m.queue) > 0 {
+		job := m.queue[0]
+		m.queue = m.queue[1:]
+		m.running++
+		job.state = utils.JobRunning
+		job.started = time.Now()
+		job.share = m.scheduler.register(job.info)
+		log.Printf("[JOB] Avvio del job %s (%d in esecuzione, %d in coda)\n", job.info.ID, m.running, len(m.queue))
+		go job.run()
+	}
+}
+
+// Posizione del job nella coda, da 1 (0 se non è in coda)
+func (m *Master) queuePositionLocked(job *Job) int {
+	for i, queued := range m.queue {
+		if queued == job {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Attende che non ci siano job in coda né in esecuzione
+func (m *Master) waitIdle() {
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+	for m.running > 0 || len(m.queue) > 0 {
+		m.idle.Wait()
+	}
+}
+
+// Esegue il job fino all'output finale e lo chiude
+func (j *Job) run() {
+	j.finish(runJob(j))
+}
+
+// Chiude il job: err nil = completato, errJobCanceled = annullato, altrimenti fallito.
+// Conserva l'avanzamento finale in result.json, cancella il resto dello stato e l'output parziale
+// dei job non completati, chiede ai worker di eliminare i file del job e avvia il job successivo.
+func (j *Job) finish(err error) {
+	chunks, partitions, _ := j.progress()
+
+	m := j.Master
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+
+	switch {
+	case err == nil:
+		j.state = utils.JobCompleted
+	case errors.Is(err, errJobCanceled):
+		j.state = utils.JobCanceled
+	default:
+		j.state = utils.JobFailed
+		j.err = err.Error()
+	}
+	j.finished = time.Now()
+	j.chunks, j.partitions = chunks, partitions
+	j.scheduling = m.scheduler.unregister(j.share)
+	log.Printf("[JOB] Job %s: %s\n", j.info.ID, j.state)
+
+	j.close()
+	if j.state == utils.JobCompleted {
+		utils.CleanupJobTempFiles(j.info.ID)
+	} else {
+		utils.CleanupJobOutput(j.info.ID)
+	}
+	go j.release()
+
+	m.running--
+	m.evictLocked()
+	m.dispatchLocked()
+	m.idle.Broadcast()
+}
+
+// Annulla un job ancora in coda (con jobMu acquisito)
+func (m *Master) cancelQueuedLocked(job *Job) {
+	for i, queued := range m.queue {
+		if queued == job {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	job.state = utils.JobCanceled
+	job.finished = time.Now()
+	log.Printf("[JOB] Job %s annullato prima dell'avvio\n", job.info.ID)
+
+	job.close()
+	m.evictLocked()
+	m.idle.Broadcast()
+}
+
+// Salva il risultato del job concluso e ne cancella lo stato, tranne job.json e result.json
+func (j *Job) close() {
+	result := utils.JobStatus{JobInfo: j.info, State: j.state, Error: j.err, Phase: "done", Chunks: j.chunks, Partitions: j.partitions, Scheduling: j.scheduling}
+	if !j.started.IsZero() {
+		started := j.started
+		result.Started = &started
+	}
+	finished := j.finished
+	result.Finished = &finished
+	if err := j.store.SaveResult(result); err != nil {
+		log.Printf("[STATE] Errore salvataggio del risultato del job %s: %v\n", j.info.ID, err)
+	}
+	j.store.Reset()
+}
+
+// Ripristina un job concluso prima del riavvio del master dal suo result.json
+func (j *Job) restore(result utils.JobStatus) {
+	j.state, j.err = result.State, result.Error
+	if result.Started != nil {
+		j.started = *result.Started
+	}
+	if result.Finished != nil {
+		j.finished = *result.Finished
+	}
+	j.chunks, j.partitions = result.Chunks, result.Partitions
+	j.scheduling = result.Scheduling
+}
+
+// Elimina stato e output dei job conclusi più vecchi oltre settings.jobs.history (con jobMu acquisito)
+func (m *Master) evictLocked() {
+	_, _, history := m.jobLimits()
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.state != utils.JobQueued && job.state != utils.JobRunning {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= history {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].finished.Before(finished[b].finished) })
+	for _, job := range finished[:len(finished)-history] {
+		job.store.Remove()
+		utils.CleanupJobOutput(job.info.ID)
+		delete(m.jobs, job.info.ID)
+		log.Printf("[JOB] Job %s rimosso dallo storico\n", job.info.ID)
+	}
+}
+
+// Chiede a tutti i worker di eliminare run, partizioni e segmenti del job concluso.
+// Best effort: un worker non raggiungibile conserva i file fino alla pulizia periodica o al riavvio.
+func (j *Job) release() {
+	for _, w := range j.registeredWorkers() {
+		if j.liveness.IsDead(w.Address) {
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", w.Address, 3*time.Second)
+		if err != nil {
+			log.Printf("[JOB] Rilascio del job %s su %s non riuscito: %v\n", j.info.ID, w.Address, err)
+			continue
+		}
+		client := rpc.NewClient(conn)
+		reply := utils.ReleaseJobReply{}
+		if err := client.Call("Worker.ReleaseJob", utils.ReleaseJobRequest{JobID: j.info.ID}, &reply); err != nil {
+			log.Printf("[JOB] Rilascio del job %s su %s non riuscito: %v\n", j.info.ID, w.Address, err)
+		}
+		client.Close()
+	}
+}
+
+// Recupera i job salvati nello store: i job conclusi tornano nello storico, gli altri vengono
+// rimessi in coda in ordine di invio e ripresi dallo stato salvato. Restituisce i job ripresi.
+func (m *Master) recoverJobs() int {
+	ids, err := utils.ListJobStates()
+	checkState(err)
+
+	var pending []*Job
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+	for _, id := range ids {
+		store := utils.NewJobState(id)
+		info, ok, err := store.LoadJobInfo()
+		checkState(err)
+		if !ok {
+			continue
+		}
+		job := m.newJob(info)
+		result, done, err := store.LoadResult()
+		checkState(err)
+		if done {
+			job.restore(result)
+			m.jobs[id] = job
+			continue
+		}
+		pending = append(pending, job)
+	}
+
+	sort.Slice(pending, func(a, b int) bool { return pending[a].info.Submitted.Before(pending[b].info.Submitted) })
+	for _, job := range pending {
+		log.Printf("[RECOVERY] Riprendo il job %s\n", job.info.ID)
+		m.enqueueLocked(job)
+	}
+	m.evictLocked()
+	return len(pending)
+}
+
+// Errore che interrompe il job. Con api.serve, o per i job inviati all'API, il job fallisce e il
+// master passa ai job successivi; altrimenti il master termina e al riavvio riprende il job dallo stato salvato.
+func (j *Job) fatal(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if !j.serving() && !j.info.API {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("[JOB] Job %s interrotto: %v\n", j.info.ID, err)
+	return err
+}
+
+// Canale chiuso quando il job viene annullato
+func (j *Job) jobCanceled() <-chan struct{} {
+	return j.cancel
+}
+
+// Indica se il job è stato annullato
+func (j *Job) jobAborted() bool {
+	select {
+	case <-j.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// Registra il fallimento di un task del job, consultabile con GET /jobs/{id}/failures
+func (j *Job) recordFailure(kind, task, attemptID, worker string, cause error) {
+	j.jobMu.Lock()
+	defer j.jobMu.Unlock()
+	j.failures = append(j.failures, utils.TaskFailure{
+		Seq:       len(j.failures) + 1,
+		Time:      time.Now(),
+		Kind:      kind,
+		Task:      task,
+		AttemptID: attemptID,
+		Worker:    worker,
+		Error:     cause.Error(),
+	})
+}
+
+// Avanzamento del job secondo la tabella dei task
+func (j *Job) progress() (chunks []utils.ChunkProgress, partitions []utils.PartitionProgress, phase string) {
+	phase = utils.MapTaskKind
+	table, err := j.store.LoadTaskTable()
+	if err != nil {
+		log.Printf("[API] Stato dei task del job %s non leggibile: %v\n", j.info.ID, err)
+		return nil, nil, phase
+	}
+
+	for id, task := range table.Map {
+		n, _ := strconv.Atoi(id)
+		chunks = append(chunks, utils.ChunkProgress{ID: n, State: task.State, AttemptID: task.AttemptID, Worker: task.Worker, Error: task.Error})
+	}
+	sort.Slice(chunks, func(a, b int) bool { return chunks[a].ID < chunks[b].ID })
+
+	if len(table.Reduce) > 0 {
+		phase = utils.ReduceTaskKind
+	}
+	spec := j.Partitioning()
+	for _, owner := range spec.Reducers {
+		state := utils.TaskPending
+		if task := table.Reduce[owner]; task != nil {
+			state = task.State
+		}
+		partitions = append(partitions, utils.PartitionProgress{Owner: owner, Reducer: spec.Target(owner), State: state})
+	}
+	return chunks, partitions, phase
+}
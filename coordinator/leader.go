@@ -0,0 +1,271 @@
+package coordinator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sdcc-mapreduce/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ========================================================================================
+// Elezione del leader: un solo master attivo tra master e standby
+// ========================================================================================
+
+// Il leader è registrato in state/leader.json sullo store condiviso e lo rinnova ogni leaseRenew.
+// Un candidato considera scaduto il lease se il record non cambia per leaseTimeout, misurato
+// sul proprio orologio (nessuna ipotesi sulla sincronizzazione tra host), e lo sostituisce con
+// un compare-and-swap che incrementa Term. Il leader considera valido il lease solo per
+// leaseTimeout - 2*leaseRenew dall'ultimo rinnovo riuscito: oltre quel limite non scrive più
+// stato e termina, prima che uno standby possa subentrare.
+
+const leaderKey = "state/leader.json"
+
+// Variabili per poterle accorciare nei test
+var (
+	leaseRenew   = 2 * time.Second
+	leaseTimeout = 10 * time.Second
+)
+
+// Restituito dallo store del master quando il lease non è più valido
+var errNotLeader = errors.New("leadership non più valida")
+
+// Durata del lease per il leader, con un margine sulla scadenza vista dagli standby
+func leaseValidity() time.Duration {
+	return leaseTimeout - 2*leaseRenew
+}
+
+// Record del leader in leader.json
+type leaderRecord struct {
+	ID       string    `json:"id"`
+	Address  string    `json:"address"` // Indirizzo RPC per i worker
+	Term     int       `json:"term"`    // Incrementato a ogni cambio di leader
+	Renewals int       `json:"renewals"`
+	Renewed  time.Time `json:"renewed"` // Solo informativo: la scadenza la misura chi osserva
+}
+
+// Leadership detenuta da questa istanza
+type leadership struct {
+	mu       sync.Mutex
+	record   leaderRecord
+	data     []byte // Contenuto attuale di leader.json, valore atteso dal prossimo rinnovo
+	resigned bool
+
+	// Scadenza del lease (UnixNano), letta dallo store protetto senza attendere un rinnovo in corso
+	expires atomic.Int64
+}
+
+// Identità dell'istanza: Options.ID, altrimenti MASTER_ID, altrimenti l'hostname
+func instanceID(opts Options) string {
+	if opts.ID != "" {
+		return opts.ID
+	}
+	if id := os.Getenv("MASTER_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("[LEADER] Identità dell'istanza non disponibile: %v", err)
+	}
+	return host
+}
+
+// Attende di diventare leader. Un'istanza con lo stesso ID del leader registrato è lo stesso
+// master riavviato e riprende subito il controllo. Restituisce nil se uno standby trova
+// il lease libero ma la computazione conclusa (completed.json).
+func campaign(opts Options) *leadership {
+	id := instanceID(opts)
+	var seen []byte      // Ultimo record osservato
+	seenAt := time.Now() // Da quando il record non cambia
+	waiting := false
+
+	for {
+		current, err := utils.Store().Get(leaderKey)
+		if err == utils.ErrNotFound {
+			current = nil
+		} else if err != nil {
+			log.Printf("[LEADER] Errore lettura di %s: %v", leaderKey, err)
+			time.Sleep(leaseRenew)
+			continue
+		}
+
+		var prev leaderRecord
+		if current != nil {
+			if err := json.Unmarshal(current, &prev); err != nil {
+				log.Printf("[LEADER] %s non valido, lo considero scaduto: %v", leaderKey, err)
+			}
+		}
+		if !bytes.Equal(current, seen) {
+			seen, seenAt = current, time.Now()
+		}
+
+		if current != nil && prev.ID != id && time.Since(seenAt) < leaseTimeout {
+			if !waiting {
+				log.Printf("[LEADER] Leader attivo: %s (term %d), attendo la scadenza del lease", prev.ID, prev.Term)
+				waiting = true
+			}
+			time.Sleep(leaseRenew)
+			continue
+		}
+		if opts.Standby && utils.CompletionFlagExists() {
+			log.Println("[LEADER] Computazione conclusa, nessun master da sostituire")
+			return nil
+		}
+
+		next := leaderRecord{ID: id, Address: net.JoinHostPort(id, "9000"), Term: prev.Term + 1, Renewed: time.Now()}
+		data, err := json.Marshal(next)
+		if err != nil {
+			log.Fatalf("[LEADER] Errore serializzazione di %s: %v", leaderKey, err)
+		}
+		start := time.Now()
+		ok, err := utils.Store().CompareAndSwap(leaderKey, current, data)
+		if err != nil {
+			log.Printf("[LEADER] Errore acquisizione della leadership: %v", err)
+			time.Sleep(leaseRenew)
+			continue
+		}
+		if !ok {
+			// Un altro candidato è arrivato prima: si torna a osservare il nuovo record
+			continue
+		}
+		if current != nil && prev.ID != id {
+			log.Printf("[LEADER] Lease di %s scaduto: %s prende il controllo (term %d)", prev.ID, id, next.Term)
+		} else {
+			log.Printf("[LEADER] %s è il leader (term %d)", id, next.Term)
+		}
+		l := &leadership{record: next, data: data}
+		l.extend(start)
+		return l
+	}
+}
+
+// Rinnova il lease finché la leadership non viene ceduta. Termina il processo se un'altra
+// istanza ha preso il controllo o se il lease non viene rinnovato prima della sua scadenza:
+// ogni rinnovo ha come limite il tempo di lease rimasto, anche se lo store non risponde.
+func (l *leadership) keep() {
+	for range time.Tick(leaseRenew) {
+		l.mu.Lock()
+		if l.resigned {
+			l.mu.Unlock()
+			return
+		}
+		next := l.record
+		next.Renewals++
+		next.Renewed = time.Now()
+		data, err := json.Marshal(next)
+		if err != nil {
+			log.Fatalf("[LEADER] Errore serializzazione di %s: %v", leaderKey, err)
+		}
+		start := time.Now()
+		ok, err := l.renew(data)
+		switch {
+		case err != nil:
+			log.Printf("[LEADER] Errore rinnovo del lease: %v", err)
+			if !l.valid() {
+				log.Fatalf("[LEADER] Lease scaduto senza rinnovo (term %d): cedo il controllo", l.record.Term)
+			}
+		case !ok:
+			l.expires.Store(0)
+			log.Fatalf("[LEADER] Leadership persa (term %d): un'altra istanza ha preso il controllo", l.record.Term)
+		default:
+			l.record, l.data = next, data
+			l.extend(start)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Compare-and-swap di leader.json entro la scadenza del lease. Senza risposta in tempo il
+// lease è perso: il processo termina invece di attendere il timeout dello store.
+func (l *leadership) renew(data []byte) (bool, error) {
+	type result struct {
+		ok  bool
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ok, err := utils.Store().CompareAndSwap(leaderKey, l.data, data)
+		done <- result{ok, err}
+	}()
+	select {
+	case r := <-done:
+		return r.ok, r.err
+	case <-time.After(time.Until(time.Unix(0, l.expires.Load()))):
+		l.expires.Store(0)
+		log.Fatalf("[LEADER] Rinnovo del lease senza risposta entro la scadenza (term %d): cedo il controllo", l.record.Term)
+		return false, nil
+	}
+}
+
+// Estende il lease a partire dall'invio del rinnovo riuscito: il record è cambiato solo dopo
+func (l *leadership) extend(sent time.Time) {
+	l.expires.Store(sent.Add(leaseValidity()).UnixNano())
+}
+
+// Indica se il lease di questa istanza è ancora valido
+func (l *leadership) valid() bool {
+	return time.Now().UnixNano() < l.expires.Load()
+}
+
+// ========================================================================================
+// Store protetto dal lease: un leader deposto non scrive più lo stato
+// ========================================================================================
+
+// fencedStore rifiuta le scritture (tranne leader.json, gestito dall'elezione) quando il term per
+// cui è stato creato non è stato confermato sullo store, con un rinnovo riuscito, entro la durata
+// del lease. Le letture restano libere.
+type fencedStore struct {
+	utils.StateStore
+	leader *leadership
+	term   int
+}
+
+// Store che accetta scritture solo finché questa istanza detiene il lease
+func (l *leadership) fence(store utils.StateStore) utils.StateStore {
+	return &fencedStore{StateStore: store, leader: l, term: l.record.Term}
+}
+
+func (s *fencedStore) check(key string) error {
+	if key == leaderKey || s.leader.valid() {
+		return nil
+	}
+	return fmt.Errorf("%w (term %d): scrittura di %s rifiutata", errNotLeader, s.term, key)
+}
+
+func (s *fencedStore) Put(key string, data []byte) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.StateStore.Put(key, data)
+}
+
+func (s *fencedStore) Delete(key string) error {
+	if err := s.check(key); err != nil {
+		return err
+	}
+	return s.StateStore.Delete(key)
+}
+
+func (s *fencedStore) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	if err := s.check(key); err != nil {
+		return false, err
+	}
+	return s.StateStore.CompareAndSwap(key, old, new)
+}
+
+// Cede la leadership a computazione conclusa
+func (l *leadership) resign() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resigned = true
+	l.expires.Store(0)
+	if err := utils.Store().Delete(leaderKey); err != nil {
+		log.Printf("[LEADER] Errore rimozione di %s: %v", leaderKey, err)
+	}
+}
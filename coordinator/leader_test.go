@@ -0,0 +1,162 @@
+package coordinator
+
+import (
+	"errors"
+	"sdcc-mapreduce/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Store locale vuoto per il test e lease accorciato; ripristinati a fine test
+func testLease(t *testing.T) utils.StateStore {
+	t.Helper()
+	prevRenew, prevTimeout := leaseRenew, leaseTimeout
+	t.Cleanup(func() { leaseRenew, leaseTimeout = prevRenew, prevTimeout })
+	leaseRenew, leaseTimeout = 50*time.Millisecond, 500*time.Millisecond
+	return testStore(t)
+}
+
+// Senza rinnovi il leader smette di scrivere lo stato prima che uno standby possa subentrare
+func TestFencedStoreRejectsWritesAfterLease(t *testing.T) {
+	store := testLease(t)
+	leader := campaign(Options{ID: "a"})
+	fenced := leader.fence(store)
+
+	if err := fenced.Put("state/status.json", []byte("{}")); err != nil {
+		t.Fatalf("scrittura con lease valido rifiutata: %v", err)
+	}
+	time.Sleep(leaseValidity())
+
+	if err := fenced.Put("state/status.json", []byte("{}")); !errors.Is(err, errNotLeader) {
+		t.Errorf("Put dopo la scadenza del lease: %v", err)
+	}
+	if err := fenced.Delete("state/status.json"); !errors.Is(err, errNotLeader) {
+		t.Errorf("Delete dopo la scadenza del lease: %v", err)
+	}
+	if _, err := fenced.CompareAndSwap("state/status.json", nil, []byte("{}")); !errors.Is(err, errNotLeader) {
+		t.Errorf("CompareAndSwap dopo la scadenza del lease: %v", err)
+	}
+	if data, err := fenced.Get("state/status.json"); err != nil || string(data) != "{}" {
+		t.Errorf("lettura dopo la scadenza del lease: %q, %v", data, err)
+	}
+	// leader.json resta gestito dall'elezione
+	if err := fenced.Delete(leaderKey); err != nil {
+		t.Errorf("rimozione di %s rifiutata: %v", leaderKey, err)
+	}
+}
+
+// Finché il leader rinnova il lease un secondo candidato non vince; alla cessione subentra
+func TestCampaignWaitsWhileLeaseRenewed(t *testing.T) {
+	testLease(t)
+	leader := campaign(Options{ID: "a"})
+	go leader.keep()
+
+	won := make(chan *leadership, 1)
+	go func() { won <- campaign(Options{ID: "b"}) }()
+	select {
+	case other := <-won:
+		t.Fatalf("b eletto (term %d) mentre a rinnova il lease", other.record.Term)
+	case <-time.After(3 * leaseTimeout):
+	}
+	if !leader.valid() {
+		t.Error("lease di a scaduto nonostante i rinnovi")
+	}
+
+	leader.resign()
+	select {
+	case other := <-won:
+		if other.record.ID != "b" {
+			t.Errorf("eletto %s, atteso b", other.record.ID)
+		}
+		other.resign()
+	case <-time.After(3 * leaseTimeout):
+		t.Fatal("b non eletto dopo la cessione di a")
+	}
+}
+
+// Un leader che smette di rinnovare (crash) viene sostituito solo dopo leaseTimeout, con un nuovo term;
+// da quel momento le sue scritture vengono rifiutate e quelle del nuovo leader accettate
+func TestCampaignTakesOverExpiredLease(t *testing.T) {
+	store := testLease(t)
+	old := campaign(Options{ID: "a"})
+	oldStore := old.fence(store)
+
+	start := time.Now()
+	leader := campaign(Options{ID: "b"})
+	if elapsed := time.Since(start); elapsed < leaseTimeout {
+		t.Errorf("b eletto dopo %v, prima della scadenza del lease (%v)", elapsed, leaseTimeout)
+	}
+	if leader.record.ID != "b" || leader.record.Term != old.record.Term+1 {
+		t.Errorf("eletto %s con term %d, atteso b con term %d", leader.record.ID, leader.record.Term, old.record.Term+1)
+	}
+
+	if err := oldStore.Put("state/status.json", []byte("a")); !errors.Is(err, errNotLeader) {
+		t.Errorf("scrittura del leader deposto: %v", err)
+	}
+	if err := leader.fence(store).Put("state/status.json", []byte("b")); err != nil {
+		t.Errorf("scrittura del nuovo leader: %v", err)
+	}
+	if data, _ := store.Get("state/status.json"); string(data) != "b" {
+		t.Errorf("stato %q, atteso quello del nuovo leader", data)
+	}
+}
+
+// Store che trattiene il primo compare-and-swap finché il test non lo rilascia
+type blockingStore struct {
+	utils.StateStore
+	once    sync.Once
+	blocked chan struct{} // Chiuso quando il primo compare-and-swap è in attesa
+	release chan struct{}
+}
+
+func (s *blockingStore) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	first := false
+	s.once.Do(func() { first = true })
+	if first {
+		close(s.blocked)
+		<-s.release
+	}
+	return s.StateStore.CompareAndSwap(key, old, new)
+}
+
+// resign durante un rinnovo in corso attende il rinnovo, poi rimuove il record e ferma keep
+func TestResignDuringRenew(t *testing.T) {
+	store := testLease(t)
+	leader := campaign(Options{ID: "a"})
+	blocking := &blockingStore{StateStore: store, blocked: make(chan struct{}), release: make(chan struct{})}
+	utils.SetStore(blocking)
+
+	kept := make(chan struct{})
+	go func() {
+		leader.keep()
+		close(kept)
+	}()
+	<-blocking.blocked
+
+	resigned := make(chan struct{})
+	go func() {
+		leader.resign()
+		close(resigned)
+	}()
+	select {
+	case <-resigned:
+		t.Fatal("resign concluso durante il rinnovo")
+	case <-time.After(2 * leaseRenew):
+	}
+	close(blocking.release)
+
+	for name, done := range map[string]chan struct{}{"resign": resigned, "keep": kept} {
+		select {
+		case <-done:
+		case <-time.After(leaseTimeout):
+			t.Fatalf("%s non terminato dopo il rinnovo", name)
+		}
+	}
+	if _, err := store.Get(leaderKey); err != utils.ErrNotFound {
+		t.Errorf("%s dopo resign: %v", leaderKey, err)
+	}
+	if leader.valid() {
+		t.Error("lease ancora valido dopo resign")
+	}
+}
@@ -0,0 +1,518 @@
+package coordinator
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ========================================================================================
+// Struct Master 
+// ========================================================================================
+
+// Master rappresenta il nodo centrale: registra i worker e ne esegue i job, uno o più alla volta
+type Master struct {
+	Workers  []utils.WorkerConfig // Lista dei worker (mappers e reducers)
+	mu       sync.Mutex  // per accesso concorrente a workers
+	liveness *Liveness   // Stato dei worker secondo gli heartbeat
+
+	defaults utils.Settings  // Impostazioni di config.json, base dei job inviati all'API
+	jobMu    sync.Mutex      // per accesso concorrente alla coda e allo stato dei job
+	jobs     map[string]*Job // Job in coda, in esecuzione e conclusi (storico)
+	queue    []*Job          // Job in attesa, in ordine di invio
+	running  int             // Job in esecuzione
+	idle     *sync.Cond      // Segnalata alla conclusione di ogni job
+
+	scheduler *Scheduler // Divisione degli slot dei worker tra i job in esecuzione
+}
+
+// ========================================================================================
+// Recupero Mapper e Reducer da config
+// ========================================================================================
+
+// Copia dei worker registrati: Register e gli heartbeat modificano la lista in concorrenza con i job
+func (m *Master) registeredWorkers() []utils.WorkerConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]utils.WorkerConfig(nil), m.Workers...)
+}
+
+// Recupera solo i mapper
+func (m *Master) getMappers() (mappers []utils.WorkerConfig, numMappers int) {
+	numMappers = 0
+	for _, worker := range m.registeredWorkers() {
+		if worker.Role == "mapper" {
+			mappers = append(mappers, worker)
+			numMappers++
+		}
+	}
+	return
+}
+
+// Recupera solo i reducer
+func (m *Master) getReducers() (reducers []utils.WorkerConfig, numReducers int) {
+	numReducers = 0
+	for _, worker := range m.registeredWorkers() {
+		if worker.Role == "reducer" {
+			reducers = append(reducers, worker)
+			numReducers++
+		}
+	}
+	return
+}
+
+// ========================================================================================
+// Generazione e Suddivisione dati
+// ========================================================================================
+
+// Pianifica count numeri casuali nel range [xi, xf], divisi in numMappers chunk generati:
+// il master salva solo seed e dimensioni, i mapper rigenerano i valori in streaming
+func (j *Job) GenerateData(count, xi, xf int) []utils.ChunkData {
+	_, numChunks := j.getMappers()
+	chunkSize := int(math.Ceil(float64(count) / float64(numChunks)))
+	chunks := utils.PlanGeneratedChunks(time.Now().UnixNano(), count, chunkSize, xi, xf)
+
+	// Crea cartella se non esiste
+	_ = os.MkdirAll(j.outDir, os.ModePerm)
+
+	// Crea file leggibile, scrivendo i valori un chunk alla volta
+	dataPath := filepath.Join(j.outDir, "data.txt")
+	txtFile, err := os.Create(dataPath)
+	if err != nil {
+		log.Printf("Errore creazione %s: %v", dataPath, err)
+		return chunks
+	}
+	defer txtFile.Close()
+	writer := bufio.NewWriter(txtFile)
+
+	for _, c := range chunks {
+		c.Each(func(r utils.Record) error {
+			_, err := fmt.Fprintln(writer, r.Key)
+			return err
+		})
+	}
+
+	writer.Flush()
+	log.Printf("Pianificati %d chunk generati (%d valori), salvati anche in %s\n", len(chunks), count, dataPath)
+
+	return chunks
+}
+
+
+// Carica il dataset dalla sorgente configurata in settings.input
+func (j *Job) LoadInput() ([]utils.Record, error) {
+	source, err := utils.NewInputSource(*j.Settings.Input, j.keyType())
+	if err != nil {
+		return nil, err
+	}
+	data, err := source.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("nessun valore letto da %s", j.Settings.Input.Path)
+	}
+
+	log.Printf("Letti %d record da %s\n", len(data), j.Settings.Input.Path)
+	return data, nil
+}
+
+// Indica se i dati vengono generati casualmente invece che letti da settings.input
+func (j *Job) generatedInput() bool {
+	return j.Settings.Input == nil || j.Settings.Input.Path == ""
+}
+
+// Tipo delle chiavi del job (risolto all'avvio da runJob)
+func (j *Job) keyType() utils.KeyType {
+	return j.keys
+}
+
+// Divide i record in numMappers chunk, da assegnare ai mapper
+func (j *Job) SplitData(data []utils.Record) []utils.ChunkData {
+	_, numChunks := j.getMappers()
+	chunkSize := int(math.Ceil(float64(len(data)) / float64(numChunks)))
+	chunks := make([]utils.ChunkData, 0)
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, utils.ChunkData{Records: data[i:end]})
+	}
+	return chunks
+}
+
+
+// ========================================================================================
+// Logica e Fase MAP
+// ========================================================================================
+
+// Metodo RPC chiamato dai worker per registrarsi al master
+func (m *Master) Register(worker utils.WorkerConfig, reply *bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Evita duplicati
+	for _, w := range m.Workers {
+		if w.Address == worker.Address {
+			*reply = false
+			return nil
+		}
+	}
+
+	m.Workers = append(m.Workers, worker)
+	m.liveness.Beat(worker.Address)
+	log.Printf("Registrato nuovo worker: %s (%s)\n", worker.Address, worker.Role)
+	*reply = true
+	return nil
+}
+
+// Attende che si registrino tutti i worker richiesti (mapper + reducer).
+// Restituisce un errore se non si registrano entro il timeout.
+func (m *Master) WaitForWorkers(expectedMappers, expectedReducers int) error {
+	const timeoutSec = 30
+	const checkInterval = 1 * time.Second
+
+	log.Printf("Attendo la registrazione di %d mapper e %d reducer...\n", expectedMappers, expectedReducers)
+	deadline := time.Now().Add(time.Duration(timeoutSec) * time.Second)
+
+	for {
+		m.mu.Lock()
+		mappers := 0
+		reducers := 0
+		for _, w := range m.Workers {
+			if w.Role == "mapper" {
+				mappers++
+			} else if w.Role == "reducer" {
+				reducers++
+			}
+		}
+		m.mu.Unlock()
+
+		log.Printf("Registrati finora: %d mapper, %d reducer\n", mappers, reducers)
+
+		if mappers >= expectedMappers && reducers >= expectedReducers {
+			log.Println("Tutti i worker sono registrati, si può partire.")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout: non tutti i worker si sono registrati in %d secondi (%d mapper su %d, %d reducer su %d)",
+				timeoutSec, mappers, expectedMappers, reducers, expectedReducers)
+		}
+
+		time.Sleep(checkInterval)
+	}
+}
+
+
+// Esegue la fase di Map assegnando ogni chunk di dati a un mapper disponibile.
+// Con l'esecuzione speculativa abilitata i chunk lenti ricevono un tentativo di backup:
+// vale il primo tentativo che termina.
+// Restituisce un errore se almeno un chunk non è stato completato (barriera prima della Reduce).
+func (j *Job) ExecuteMapPhase(chunks []utils.Chunk) error {
+	mappers, _ := j.getMappers() // Recupera la lista dei mapper dal master
+
+	phase := &mapPhase{
+		job:           j,
+		mappers:       mappers,
+	}
+
+	for _, chunk := range chunks {
+		task := &mapTask{chunk: chunk, start: time.Now(), finished: make(chan struct{})}
+		phase.tasks = append(phase.tasks, task)
+		phase.launch(task)
+	}
+
+	// Monitor dei chunk lenti, fino alla fine della fase
+	stop := make(chan struct{})
+	if spec := j.Settings.Speculation; spec != nil && spec.Enabled {
+		go phase.speculate(newSpeculationPolicy(spec), stop)
+	}
+	// Annullamento del job dall'API
+	go phase.cancelOn(j.jobCanceled(), stop)
+
+	// Attende che ogni chunk sia completato o definitivamente fallito
+	var failed []int
+	for _, task := range phase.tasks {
+		<-task.finished
+		if task.failed {
+			failed = append(failed, task.chunk.ID)
+		}
+	}
+	close(stop)
+
+	if j.jobAborted() {
+		return errJobCanceled
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("chunk non completati: %v", failed)
+	}
+	log.Println("Fase di Map completata.")
+	return nil
+}
+
+// Quando il job viene annullato chiude i chunk non ancora completati, abbandonando i tentativi in corso
+func (p *mapPhase) cancelOn(cancel, stop <-chan struct{}) {
+	select {
+	case <-stop:
+		return
+	case <-cancel:
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, task := range p.tasks {
+		if !task.done && !task.failed {
+			task.failed = true
+			close(task.finished)
+		}
+	}
+}
+
+// mapTask è lo stato di un chunk durante la fase di Map
+type mapTask struct {
+	chunk    utils.Chunk
+	start    time.Time
+	running  int           // Tentativi in corso
+	backup   bool          // Tentativo di backup già lanciato
+	done     bool          // Un tentativo è stato accettato
+	failed   bool          // Tutti i tentativi sono falliti
+	finished chan struct{} // Chiuso quando il chunk è completato o fallito
+}
+
+// mapPhase raccoglie lo stato condiviso tra i tentativi di una fase di Map
+type mapPhase struct {
+	job           *Job
+	mappers       []utils.WorkerConfig
+
+	mu        sync.Mutex
+	tasks     []*mapTask
+	durations []time.Duration // Durate dei chunk completati
+}
+
+// Contatore per rendere univoci gli ID dei tentativi di questo processo
+var attemptCounter uint64
+
+// Genera un ID di tentativo univoco anche tra incarnazioni diverse del master
+func newAttemptID() string {
+	return fmt.Sprintf("a%x-%d", time.Now().UnixNano(), atomic.AddUint64(&attemptCounter, 1))
+}
+
+// Avvia un nuovo tentativo per il chunk
+func (p *mapPhase) launch(task *mapTask) {
+	p.mu.Lock()
+	task.running++
+	p.mu.Unlock()
+	p.start(task)
+}
+
+// Avvia un tentativo già conteggiato in task.running
+func (p *mapPhase) start(task *mapTask) {
+	attemptID := newAttemptID()
+	p.job.store.RecordMapEvent(task.chunk.ID, utils.TaskAssigned, attemptID, "", nil)
+	go p.runAttempt(task, attemptID)
+}
+
+// Esegue un tentativo di Map e, se è il primo a terminare, lo accetta e aggiorna lo stato
+func (p *mapPhase) runAttempt(task *mapTask, attemptID string) {
+	chunkIndex := task.chunk.ID
+	req := utils.MapRequest{
+		JobID: p.job.info.ID, // Namespace dei file del job sui worker
+		Chunk: task.chunk.Data, // Record del chunk
+		Partition: p.job.Partitioning(), // Assegnazione delle chiavi ai reducer, con le riassegnazioni
+		KeyType: p.job.Settings.KeyType, // Tipo delle chiavi (confronto e codifica)
+		JobType: p.job.Settings.JobType, // Job registrato da eseguire sui worker
+		ChunkID: chunkIndex,
+		AttemptID: attemptID,
+		Combine: p.job.Settings.Combiner, // Combiner prima dello shuffle
+		Shuffle: p.job.Settings.Shuffle, // push o pull
+		SortBufferMB: p.job.Settings.SortBufferMB, // Memoria per l'ordinamento esterno
+		MergeFanIn: p.job.Settings.MergeFanIn, // Run unite al più per passo di merge
+	}
+	reply := utils.MapReply{} // Struttura di risposta RPC
+
+	logPrefix := fmt.Sprintf("MAP-%02d/%s", chunkIndex, attemptID)
+	taskLabel := fmt.Sprintf("chunk %d (%d record)", chunkIndex, task.chunk.Data.Len())
+
+	// Chiamata RPC con fallback: tenta mapper disponibili e riassegna in caso di fallimento
+	var worker string
+	running := func(addr string) {
+		worker = addr
+		p.job.store.RecordMapEvent(chunkIndex, utils.TaskRunning, attemptID, addr, nil)
+	}
+	err := CallWithFallbackMapBusy(p.mappers, "Worker.MapTask", req, &reply, logPrefix, taskLabel, p.job.share, p.job.liveness, task.finished, running)
+
+	// Le partizioni non consegnate passano a un altro reducer, che le ricostruisce prima della chiusura.
+	// Se nessun reducer può riceverle il tentativo fallisce: accettarlo lascerebbe record mancanti nell'output.
+	if err == nil {
+		for _, owner := range reply.Undelivered {
+			p.job.recordFailure(utils.ReduceTaskKind, owner, attemptID, req.Partition.Target(owner), fmt.Errorf("consegna dal chunk %d non riuscita", chunkIndex))
+			if _, reassignErr := p.job.reassignPartition(owner, req.Partition.Target(owner)); reassignErr != nil {
+				err = fmt.Errorf("partizione %s non consegnata: %v", owner, reassignErr)
+				break
+			}
+		}
+	}
+
+	p.mu.Lock()
+	task.running--
+	if task.done {
+		p.mu.Unlock()
+		log.Printf("%s terminato dopo il tentativo vincente: risultato scartato\n", logPrefix)
+		return
+	}
+	if task.failed {
+		p.mu.Unlock()
+		log.Printf("%s terminato dopo l'annullamento del job: risultato scartato\n", logPrefix)
+		return
+	}
+	if err != nil {
+		log.Printf("%s fallito: %v\n", logPrefix, err)
+		p.job.store.RecordMapEvent(chunkIndex, utils.TaskFailed, attemptID, worker, err)
+		p.job.recordFailure(utils.MapTaskKind, strconv.Itoa(chunkIndex), attemptID, worker, err)
+		if task.running == 0 {
+			task.failed = true
+			close(task.finished)
+		}
+		p.mu.Unlock()
+		return
+	}
+	task.done = true
+	p.durations = append(p.durations, time.Since(task.start))
+	p.mu.Unlock()
+
+	// Senza l'evento "done" il chunk non risulta completato al riavvio: fallisce e la Reduce non parte
+	if err := p.job.store.RecordMapDone(chunkIndex, attemptID, worker, reply.Sent, reply.Segments); err != nil {
+		log.Printf("%s completato ma non registrato: %v\n", logPrefix, err)
+		p.job.recordFailure(utils.MapTaskKind, strconv.Itoa(chunkIndex), attemptID, worker, err)
+		p.mu.Lock()
+		task.failed = true
+		p.mu.Unlock()
+		close(task.finished)
+		return
+	}
+	log.Printf("%s completato e accettato\n", logPrefix)
+	close(task.finished)
+}
+
+// ========================================================================================
+// Combinazione output
+// ========================================================================================
+
+// Combina i file di output dei reducer, in ordine di partizione, nel formato configurato in settings.output
+func (j *Job) CombineOutputFiles() error {
+	partition := j.Partitioning()
+	cfg := utils.OutputConfig{}
+	if j.Settings.Output != nil {
+		cfg = *j.Settings.Output
+	}
+
+	if cfg.PerPartition {
+		return j.writePartitionOutputs(partition, cfg)
+	}
+
+	outputFile := filepath.Join(j.outDir, "final_output"+cfg.Extension())
+	out, err := utils.CreateOutputFile(outputFile, cfg, j.keyType())
+	if err != nil {
+		return fmt.Errorf("creazione del file di output: %v", err)
+	}
+
+	for _, owner := range partition.Reducers {
+		if err := copyPartition(j.partitionOutputPath(owner), out); err != nil {
+			out.Close()
+			return fmt.Errorf("scrittura output per %s: %v", owner, err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("chiusura %s: %v", outputFile, err)
+	}
+	log.Printf("Output finale scritto in: %s (%d record)\n", outputFile, out.Records)
+	return nil
+}
+
+// Scrive un file per ogni partizione in final/ e un manifest con l'ordine di concatenazione
+func (j *Job) writePartitionOutputs(partition utils.PartitionSpec, cfg utils.OutputConfig) error {
+	dir := filepath.Join(j.outDir, "final")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("creazione %s: %v", dir, err)
+	}
+
+	manifest := utils.OutputManifest{Format: cfg.Format, Compressed: cfg.Compress}
+	if manifest.Format == "" {
+		manifest.Format = "text"
+	}
+
+	for i, owner := range partition.Reducers {
+		name := fmt.Sprintf("part-%05d%s", i, cfg.Extension())
+		out, err := utils.CreateOutputFile(filepath.Join(dir, name), cfg, j.keyType())
+		if err != nil {
+			return fmt.Errorf("creazione %s: %v", name, err)
+		}
+		if err := copyPartition(j.partitionOutputPath(owner), out); err != nil {
+			out.Close()
+			return fmt.Errorf("scrittura %s: %v", name, err)
+		}
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("chiusura %s: %v", name, err)
+		}
+
+		lower, upper := partition.Range(i)
+		manifest.Partitions = append(manifest.Partitions, utils.PartitionManifest{
+			File:     name,
+			Reducer:  partition.Target(owner),
+			Lower:    lower,
+			Upper:    upper,
+			Records:  out.Records,
+			Checksum: out.Checksum(),
+		})
+		manifest.Records += out.Records
+		log.Printf("Partizione %s scritta in %s (%d record)\n", owner, name, out.Records)
+	}
+
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := utils.WriteManifest(manifestPath, manifest); err != nil {
+		return fmt.Errorf("scrittura %s: %v", manifestPath, err)
+	}
+	log.Printf("Output finale scritto in %s: %d partizioni, %d record\n", dir, len(manifest.Partitions), manifest.Records)
+	return nil
+}
+
+// File locale della partizione scaricata dal reducer
+func (j *Job) partitionOutputPath(owner string) string {
+	return filepath.Join(j.outDir, fmt.Sprintf("temp_%s.txt", strings.ReplaceAll(owner, ":", "_")))
+}
+
+// Copia i record del file temporaneo di una partizione nel file di output
+func copyPartition(tempFile string, out *utils.OutputFile) error {
+	log.Printf("Unisco il file temporaneo: %s\n", tempFile)
+
+	// Una partizione vuota ha comunque il suo file: se manca la partizione è persa e
+	// l'output non va scritto come completo
+	file, err := os.Open(tempFile)
+	if err != nil {
+		return fmt.Errorf("partizione non disponibile: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		if err := out.Write(utils.ParseRecord(scanner.Text())); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
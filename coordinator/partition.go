@@ -0,0 +1,228 @@
+package coordinator
+
+import (
+	"fmt"
+	"log"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ========================================================================================
+// Partizionamento delle chiavi tra i reducer
+// ========================================================================================
+
+// Strategie calcolate dal master: entrambe producono un partizionamento a range
+const (
+	sampledPartitioning = "sampled" // Confini dal sampling del dataset (default)
+	uniformPartitioning = "uniform" // Confini equidistanti nell'intervallo [xi, xf]
+)
+
+// Verifica che la strategia di partizionamento configurata sia utilizzabile con tipo di chiave e job
+func validatePartitioner(settings utils.Settings, kt utils.KeyType, job utils.Job) error {
+	name := settings.Partitioner
+	if settings.Skew {
+		if name != "" && name != sampledPartitioning {
+			return fmt.Errorf("skew disponibile solo con il partizionamento %q, non %q", sampledPartitioning, name)
+		}
+		if !utils.CanSplitKeys(job) {
+			return fmt.Errorf("skew non ammesso con il job %q: la sua Reduce deve vedere tutti i valori di una chiave", settings.JobType)
+		}
+	}
+	switch name {
+	case "", sampledPartitioning, utils.HashPartitioner:
+		return nil
+	case uniformPartitioning:
+		// I confini calcolati su [xi, xf] hanno senso solo con confronto numerico
+		if !utils.IsNumericKeyType(kt) {
+			return fmt.Errorf("partizionamento %q richiede chiavi numeriche (int, int64 o float)", name)
+		}
+		return nil
+	case utils.RangePartitioner:
+		return fmt.Errorf("partizionamento %q: usare %q o %q per calcolare i confini", name, sampledPartitioning, uniformPartitioning)
+	}
+	if !utils.PartitionerRegistered(name) {
+		return fmt.Errorf("partitioner sconosciuto: %q", name)
+	}
+	return nil
+}
+
+// Nomi accettati in settings.partitioner
+func partitionerChoices() []string {
+	choices := []string{sampledPartitioning, uniformPartitioning}
+	for _, name := range utils.PartitionerNames() {
+		if name != utils.RangePartitioner {
+			choices = append(choices, name)
+		}
+	}
+	return choices
+}
+
+// Calcola il partizionamento secondo settings.partitioner
+func (j *Job) ComputePartitionSpec(chunks []utils.ChunkData) (utils.PartitionSpec, error) {
+	var reducers []string
+	workers, _ := j.getReducers()
+	for _, r := range workers {
+		reducers = append(reducers, r.Address)
+	}
+
+	var spec utils.PartitionSpec
+	switch j.Settings.Partitioner {
+	case "", sampledPartitioning:
+		spec = j.sampledRanges(sampleKeys(chunks, len(reducers)), reducers)
+	case uniformPartitioning:
+		var err error
+		if spec, err = j.uniformRanges(reducers); err != nil {
+			return utils.PartitionSpec{}, err
+		}
+	default:
+		// hash o partitioner personalizzato: i mapper ricevono solo l'elenco dei reducer
+		spec = utils.PartitionSpec{Strategy: j.Settings.Partitioner, Reducers: reducers}
+	}
+
+	// Il master valida la descrizione con lo stesso codice usato dai mapper
+	if _, err := utils.NewPartitioner(spec, j.keyType()); err != nil {
+		return utils.PartitionSpec{}, fmt.Errorf("partizionamento non valido: %v", err)
+	}
+	for i, addr := range spec.Reducers {
+		lower, upper := spec.Range(i)
+		log.Printf("Reducer %s gestisce la partizione %d [%s, %s)\n", addr, i, lower, upper)
+	}
+	log.Printf("Partizionamento %q su %d reducer\n", spec.Strategy, len(spec.Reducers))
+	return spec, nil
+}
+
+// Numero massimo di chiavi nel sample: oltre questa soglia il sample non cresce con il dataset
+const maxSampleKeys = 200000
+
+// Campiona con reservoir sampling il 10% delle chiavi dei chunk (almeno una per reducer, al più
+// maxSampleKeys): i chunk generati vengono rigenerati in streaming, senza tenerli in memoria
+func sampleKeys(chunks []utils.ChunkData, numReducers int) []string {
+	total := 0
+	for _, c := range chunks {
+		total += c.Len()
+	}
+	size := total / 10
+	if size < numReducers {
+		size = numReducers
+	}
+	if size > maxSampleKeys {
+		size = maxSampleKeys
+	}
+
+	reservoir := utils.NewReservoir(size, time.Now().UnixNano())
+	for _, c := range chunks {
+		c.Each(func(r utils.Record) error {
+			reservoir.Add(r.Key)
+			return nil
+		})
+	}
+	return reservoir.Keys
+}
+
+// Ordina le chiavi campionate e prende N-1 punti di taglio equidistanti nel sample
+func (j *Job) sampledRanges(sample []string, reducers []string) utils.PartitionSpec {
+	kt := j.keyType()
+	sortKeys(sample, kt)
+
+	// Punti di taglio, senza duplicati consecutivi: con molti valori uguali si usano meno reducer.
+	// Con skew i duplicati restano: una chiave che copre c punti di taglio è calda e viene
+	// divisa tra c reducer.
+	skew := j.Settings.Skew
+	var bounds []string
+	hot := make(map[string]int)
+	if len(reducers) > 0 {
+		step := len(sample) / len(reducers)
+		for i := 1; i < len(reducers) && step > 0; i++ {
+			cut := sample[i*step]
+			if len(bounds) == 0 || kt.Compare(cut, bounds[len(bounds)-1]) > 0 {
+				bounds = append(bounds, cut)
+			} else if skew {
+				bounds = append(bounds, cut)
+				hot[cut] = countKey(sample, cut, kt)
+			}
+		}
+	}
+	for key, count := range hot {
+		log.Printf("[SKEW] Chiave calda %s: %d/%d del sample, divisa tra più reducer\n", key, count, len(sample))
+	}
+	if len(bounds) < len(reducers)-1 {
+		log.Printf("Sample troppo piccolo o ripetitivo: uso %d reducer su %d\n", len(bounds)+1, len(reducers))
+		reducers = reducers[:len(bounds)+1]
+	}
+	log.Printf("Sample di %d chiavi, confini = %v\n", len(sample), bounds)
+
+	return utils.PartitionSpec{Strategy: utils.RangePartitioner, Reducers: reducers, Bounds: bounds, Skew: len(hot) > 0}
+}
+
+// Conta le occorrenze della chiave nel sample
+func countKey(sample []string, key string, kt utils.KeyType) int {
+	n := 0
+	for _, k := range sample {
+		if kt.Compare(k, key) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Divide [xi, xf] in N intervalli di uguale ampiezza, senza guardare i dati
+func (j *Job) uniformRanges(reducers []string) (utils.PartitionSpec, error) {
+	kt := j.keyType()
+	xi, xf := j.Settings.Xi, j.Settings.Xf
+	width := float64(xf-xi+1) / float64(len(reducers))
+
+	var bounds []string
+	for i := 1; i < len(reducers); i++ {
+		cut := float64(xi) + float64(i)*width
+		text := strconv.FormatFloat(cut, 'f', -1, 64)
+		if utils.IsIntegerKeyType(kt) {
+			text = strconv.Itoa(int(cut))
+		}
+		key, err := kt.Parse(text)
+		if err != nil {
+			return utils.PartitionSpec{}, fmt.Errorf("confine %s non valido: %v", text, err)
+		}
+		if len(bounds) == 0 || kt.Compare(key, bounds[len(bounds)-1]) > 0 {
+			bounds = append(bounds, key)
+		}
+	}
+	if len(bounds) < len(reducers)-1 {
+		log.Printf("Intervallo [%d, %d] troppo stretto: uso %d reducer su %d\n", xi, xf, len(bounds)+1, len(reducers))
+		reducers = reducers[:len(bounds)+1]
+	}
+
+	return utils.PartitionSpec{Strategy: utils.RangePartitioner, Reducers: reducers, Bounds: bounds}, nil
+}
+
+// Ordina le chiavi secondo il tipo
+func sortKeys(keys []string, kt utils.KeyType) {
+	sort.Slice(keys, func(i, j int) bool {
+		return kt.Compare(keys[i], keys[j]) < 0
+	})
+}
+
+// Restituisce il partizionamento salvato in partition.json del job oppure lo calcola e lo salva:
+// tutti i percorsi di recovery partizionano con gli stessi confini e le stesse riassegnazioni
+func (j *Job) LoadOrComputePartitioning(chunks []utils.ChunkData) error {
+	saved, ok, err := j.store.LoadPartitionSpec()
+	if err != nil {
+		return fmt.Errorf("[RECOVERY] lettura del partizionamento salvato: %v", err)
+	}
+	if ok {
+		log.Printf("[RECOVERY] Uso il partizionamento salvato (%q) per %d reducer: %v\n", saved.Strategy, len(saved.Reducers), saved.Bounds)
+		j.setPartitioning(saved)
+		return nil
+	}
+
+	spec, err := j.ComputePartitionSpec(chunks)
+	if err != nil {
+		return err
+	}
+	if err := j.store.SavePartitionSpec(spec); err != nil {
+		return err
+	}
+	j.setPartitioning(spec)
+	return nil
+}
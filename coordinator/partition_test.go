@@ -0,0 +1,71 @@
+package coordinator
+
+import (
+	"reflect"
+	"sdcc-mapreduce/utils"
+	"strconv"
+	"testing"
+)
+
+// Il partizionamento uniforme richiede chiavi confrontate numericamente
+func TestValidatePartitionerUniformKeys(t *testing.T) {
+	job, err := utils.GetJob("sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := utils.Settings{JobType: "sort", Partitioner: uniformPartitioning}
+	for keyType, ok := range map[string]bool{"int": true, "int64": true, "float": true, "string": false} {
+		kt, err := utils.GetKeyType(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validatePartitioner(settings, kt, job); (err == nil) != ok {
+			t.Errorf("%s: errore %v, ammesso atteso %v", keyType, err, ok)
+		}
+	}
+}
+
+// Al riavvio il job riusa partition.json anche se i chunk darebbero confini diversi:
+// i record già consegnati ai reducer restano nella loro partizione
+func TestRestartedJobKeepsSavedPartitioning(t *testing.T) {
+	testStore(t)
+	m := servingMaster()
+	m.Workers = []utils.WorkerConfig{{Role: "reducer", Address: "r1:9001"}, {Role: "reducer", Address: "r2:9001"}}
+	info := utils.JobInfo{ID: "job-restart", Settings: utils.Settings{JobType: "sort", KeyType: "int"}}
+
+	keys := func(from, to int) []utils.ChunkData {
+		var records []utils.Record
+		for k := from; k < to; k++ {
+			records = append(records, utils.Record{Key: strconv.Itoa(k)})
+		}
+		return utils.RecordChunks([][]utils.Record{records})
+	}
+	kt, err := utils.GetKeyType("int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := m.newJob(info)
+	first.keys = kt
+	if err := first.LoadOrComputePartitioning(keys(0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	saved := first.Partitioning()
+
+	// Job ripreso dopo il crash del master, con chunk di chiavi diverse
+	restarted := m.newJob(info)
+	restarted.keys = kt
+	other := keys(1000, 1100)
+	computed, err := restarted.ComputePartitionSpec(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(computed.Bounds, saved.Bounds) {
+		t.Fatalf("confini %v uguali per chunk diversi: il test non distingue", saved.Bounds)
+	}
+	if err := restarted.LoadOrComputePartitioning(other); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.Partitioning(); !reflect.DeepEqual(got, saved) {
+		t.Errorf("partizionamento dopo il riavvio %+v, salvato %+v", got, saved)
+	}
+}
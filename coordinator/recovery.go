@@ -0,0 +1,219 @@
+package coordinator
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ========================================================================================
+// Perdita di un reducer: riassegnazione e ricostruzione della partizione
+// ========================================================================================
+
+// Numero massimo di riassegnazioni di una stessa partizione durante la fase di Reduce
+const maxPartitionRecoveries = 3
+
+// Partizionamento corrente del job, con le riassegnazioni (copia)
+func (j *Job) Partitioning() utils.PartitionSpec {
+	j.partMu.Lock()
+	defer j.partMu.Unlock()
+	return j.partition.Clone()
+}
+
+// Imposta il partizionamento calcolato o recuperato dallo stato
+func (j *Job) setPartitioning(spec utils.PartitionSpec) {
+	j.partMu.Lock()
+	defer j.partMu.Unlock()
+	j.partition = spec.Clone()
+}
+
+// Reducer che ospita ora la partizione dell'Owner
+func (j *Job) partitionTarget(owner string) string {
+	j.partMu.Lock()
+	defer j.partMu.Unlock()
+	return j.partition.Target(owner)
+}
+
+// Sposta la partizione dell'Owner dal reducer failed a un reducer vivo, preferendo quello con meno
+// partizioni, e salva il nuovo partizionamento. Se la partizione non è più su failed (già riassegnata
+// per un'altra segnalazione) non fa nulla. Restituisce il reducer che ospita la partizione.
+func (j *Job) reassignPartition(owner, failed string) (string, error) {
+	j.partMu.Lock()
+	defer j.partMu.Unlock()
+
+	if current := j.partition.Target(owner); current != failed {
+		return current, nil
+	}
+	if j.lostReducers == nil {
+		j.lostReducers = make(map[string]bool)
+	}
+	j.lostReducers[failed] = true
+
+	load := make(map[string]int)
+	for _, o := range j.partition.Reducers {
+		load[j.partition.Target(o)]++
+	}
+	best := ""
+	reducers, _ := j.getReducers()
+	for _, r := range reducers {
+		if j.lostReducers[r.Address] || j.liveness.IsDead(r.Address) {
+			continue
+		}
+		if best == "" || load[r.Address] < load[best] {
+			best = r.Address
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("nessun reducer vivo a cui riassegnare la partizione %s", owner)
+	}
+
+	if j.partition.Assigned == nil {
+		j.partition.Assigned = make(map[string]string)
+	}
+	prev, reassigned := j.partition.Assigned[owner]
+	j.partition.Assigned[owner] = best
+	if err := j.store.SavePartitionSpec(j.partition); err != nil {
+		// Un riavvio non conoscerebbe la nuova posizione della partizione
+		if reassigned {
+			j.partition.Assigned[owner] = prev
+		} else {
+			delete(j.partition.Assigned, owner)
+		}
+		return "", err
+	}
+	log.Printf("[RECOVERY] Partizione %s riassegnata dal reducer %s a %s\n", owner, failed, best)
+	return best, nil
+}
+
+// Ricostruisce la partizione dell'Owner sul reducer che la ospita ora: riesegue, solo per quella
+// partizione, i tentativi accettati dei chunk che le avevano consegnato record. Stesso chunk e stesso
+// tentativo producono le stesse run, quindi le consegne già presenti sul reducer vengono ignorate.
+func (j *Job) replayPartition(owner string) error {
+	sources, err := j.store.LoadPartitionSources(owner)
+	if err != nil {
+		return err
+	}
+	log.Printf("[RECOVERY] Ricostruisco la partizione %s su %s da %d chunk\n", owner, j.partitionTarget(owner), len(sources))
+	if err := j.rerunChunks(owner, sources); err != nil {
+		return err
+	}
+	log.Printf("[RECOVERY] Partizione %s ricostruita su %s\n", owner, j.partitionTarget(owner))
+	return nil
+}
+
+// Riesegue i tentativi accettati dei chunk indicati (chunk → tentativo) solo per la partizione
+// dell'Owner. Con lo shuffle push i mapper consegnano di nuovo al reducer della partizione;
+// con lo shuffle pull registrano la nuova posizione dei segmenti, che il reducer scaricherà.
+func (j *Job) rerunChunks(owner string, sources map[int]string) error {
+	chunks, err := j.store.LoadChunksFromFile()
+	if err != nil {
+		return err
+	}
+
+	spec := j.Partitioning()
+	target := spec.Target(owner)
+	mappers, _ := j.getMappers()
+
+	ids := make([]int, 0, len(sources))
+	for id := range sources {
+		if id < 0 || id >= len(chunks) {
+			return fmt.Errorf("chunk %d non presente in chunks.json", id)
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ids))
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			req := utils.MapRequest{
+				JobID:        j.info.ID,
+				Chunk:        chunks[id],
+				Partition:    spec,
+				KeyType:      j.Settings.KeyType,
+				JobType:      j.Settings.JobType,
+				ChunkID:      id,
+				AttemptID:    sources[id], // Stesso tentativo accettato: run identiche a quelle perse
+				Only:         []string{owner},
+				Combine:      j.Settings.Combiner,
+				Shuffle:      j.Settings.Shuffle,
+				SortBufferMB: j.Settings.SortBufferMB,
+				MergeFanIn:   j.Settings.MergeFanIn,
+			}
+			reply := utils.MapReply{}
+			logPrefix := fmt.Sprintf("REPLAY-%s/%02d", owner, id)
+			label := fmt.Sprintf("chunk %d per la partizione %s", id, owner)
+			err := CallWithFallbackMapBusy(mappers, "Worker.MapTask", req, &reply, logPrefix, label, j.share, j.liveness, j.jobCanceled(), nil)
+			if err == nil && len(reply.Undelivered) > 0 {
+				err = fmt.Errorf("reducer %s non raggiungibile durante la ricostruzione", target)
+			}
+			if err == nil && j.pullShuffle() {
+				err = j.store.RecordMapSegments(id, sources[id], reply.Segments)
+			}
+			if err != nil {
+				errs <- fmt.Errorf("%s: %v", label, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Scarica dal reducer il file della partizione chiusa in temp_<owner>.txt nell'output del job, dove lo legge
+// CombineOutputFiles. Il file locale viene rinominato solo a download completato.
+func (j *Job) fetchPartition(owner, addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return err
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	path := j.partitionOutputPath(owner)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+
+	var offset int64
+	for {
+		reply := utils.FetchReply{}
+		err = client.Call("Worker.FetchOutput", utils.FetchRequest{JobID: j.info.ID, Owner: owner, Offset: offset}, &reply)
+		if err == nil {
+			_, err = writer.Write(reply.Data)
+		}
+		if err != nil || reply.EOF {
+			break
+		}
+		offset += int64(len(reply.Data))
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,181 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sdcc-mapreduce/utils"
+	"sync"
+)
+
+// ========================================================================================
+// Fase REDUCE
+// ========================================================================================
+
+// Esegue la fase di Reduce dopo la barriera di fine Map: chiede a ogni reducer di chiudere
+// la propria partizione e ne scarica il risultato, ricostruendo altrove le partizioni dei reducer
+// persi, e traccia lo stato nel log dei task.
+// Restituisce un errore se almeno una partizione non è stata completata.
+func (j *Job) ExecuteReducePhase() error {
+	if j.jobAborted() {
+		return errJobCanceled
+	}
+	owners := j.Partitioning().Reducers
+	if err := j.store.InitReduceStatusFile(owners); err != nil {
+		return err
+	}
+
+	pending, err := j.store.RecoverPendingPartitions()
+	if err != nil {
+		return fmt.Errorf("stato Reduce non leggibile: %v", err)
+	}
+	if len(pending) == 0 {
+		log.Println("[REDUCE] Tutte le partizioni sono già completate.")
+		return nil
+	}
+
+	// Record attesi per ogni partizione, dichiarati dai mapper
+	expected, nChunks, err := j.store.LoadShuffleCounts()
+	if err != nil {
+		return fmt.Errorf("conteggi dello shuffle non leggibili: %v", err)
+	}
+	log.Printf("[REDUCE] Avvio fase di Reduce su %d partizioni (conteggi da %d chunk)\n", len(pending), nChunks)
+
+	// Solo le run dei tentativi di Map accettati entrano nel merge
+	accepted, err := j.store.LoadAcceptedAttempts()
+	if err != nil {
+		return fmt.Errorf("tentativi accettati non leggibili: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+
+	for _, owner := range pending {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+
+			reply, err := j.closePartition(owner, expected[owner], accepted)
+			if errors.Is(err, errJobCanceled) {
+				return
+			}
+			if err != nil {
+				log.Printf("[REDUCE] Partizione %s fallita: %v\n", owner, err)
+				j.recordFailure(utils.ReduceTaskKind, owner, "", j.partitionTarget(owner), err)
+				appendToFile("/app/log/log_master/failed_tasks.log", fmt.Sprintf("REDUCE-%s: %v\n", owner, err))
+				if err := j.store.SaveReduceStatus(owner, "failed"); err != nil {
+					log.Printf("[REDUCE] %v\n", err)
+				}
+				mu.Lock()
+				failed = append(failed, owner)
+				mu.Unlock()
+				return
+			}
+
+			log.Printf("[REDUCE] Partizione %s completata: %d run (%d passi di merge), %d record in ingresso (%d valori), %d in uscita\n",
+				owner, reply.Runs, reply.MergePasses, reply.InputRecords, reply.InputValues, reply.OutputRecords)
+			// Senza lo stato "done" la partizione verrebbe chiusa di nuovo al riavvio: il job fallisce
+			if err := j.store.SaveReduceStatus(owner, "done"); err != nil {
+				log.Printf("[REDUCE] Partizione %s non registrata: %v\n", owner, err)
+				mu.Lock()
+				failed = append(failed, owner)
+				mu.Unlock()
+			}
+		}(owner)
+	}
+	wg.Wait()
+
+	if j.jobAborted() {
+		return errJobCanceled
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("partizioni non completate: %v", failed)
+	}
+	log.Println("Fase di Reduce completata.")
+	return nil
+}
+
+// Chiude la partizione dell'Owner sul reducer che la ospita e ne scarica il risultato.
+// Se il reducer non risponde la partizione viene riassegnata a un altro reducer e ricostruita
+// rieseguendo i mapper; se mancano record (es. reducer riavviato) viene ricostruita sullo stesso.
+// Con lo shuffle pull il reducer scarica i segmenti dai mapper prima di ogni chiusura, quindi
+// la ricostruzione non riesegue la Map.
+func (j *Job) closePartition(owner string, expected int, accepted map[int]string) (utils.FinalizeReply, error) {
+	req := utils.FinalizeRequest{JobID: j.info.ID, Owner: owner, JobType: j.Settings.JobType, KeyType: j.Settings.KeyType, Accepted: accepted, MergeFanIn: j.Settings.MergeFanIn}
+	logPrefix := fmt.Sprintf("FINALIZE-%s", owner)
+	rebuilt := false // La partizione è già stata ricostruita sul reducer attuale
+
+	for recoveries := 0; recoveries <= maxPartitionRecoveries; {
+		if j.jobAborted() {
+			return utils.FinalizeReply{}, errJobCanceled
+		}
+		target := j.partitionTarget(owner)
+
+		var reply utils.FinalizeReply
+		var err error
+		if j.liveness.IsDead(target) {
+			err = fmt.Errorf("reducer %s morto secondo gli heartbeat", target)
+		} else {
+			// Download dei segmenti e merge occupano uno slot del reducer, condiviso con gli altri job
+			err = j.share.acquireOn("reducer", target, j.jobCanceled())
+			if errors.Is(err, errJobCanceled) {
+				return utils.FinalizeReply{}, err
+			}
+			if err == nil {
+				if j.pullShuffle() {
+					err = j.pullPartition(owner, target)
+				}
+				if err == nil {
+					err = CallWithRetry(target, "Worker.FinalizeReduce", req, &reply, logPrefix, "partizione "+owner)
+				}
+				j.share.release("reducer", target)
+				if errors.Is(err, errShuffleLost) {
+					return utils.FinalizeReply{}, err
+				}
+			}
+		}
+
+		if err == nil {
+			// Con la consegna idempotente un numero diverso dai record dichiarati dai mapper
+			// indica record persi o duplicati
+			if reply.InputRecords != expected {
+				mismatch := fmt.Errorf("attesi %d record, uniti %d", expected, reply.InputRecords)
+				if rebuilt || j.pullShuffle() {
+					return reply, mismatch
+				}
+				log.Printf("[REDUCE] Partizione %s su %s incompleta (%v): la ricostruisco\n", owner, target, mismatch)
+				rebuilt = true
+				if err := j.replayPartition(owner); err != nil {
+					log.Printf("[REDUCE] Ricostruzione della partizione %s fallita: %v\n", owner, err)
+					rebuilt = false
+					recoveries++
+				}
+				continue
+			}
+			if err = j.fetchPartition(owner, target); err == nil {
+				if target != owner {
+					log.Printf("[REDUCE] Partizione %s chiusa dal reducer %s\n", owner, target)
+				}
+				return reply, nil
+			}
+		}
+
+		// Reducer perso: sposta la partizione e la ricostruisce sul nuovo reducer
+		log.Printf("[REDUCE] Reducer %s non disponibile per la partizione %s: %v\n", target, owner, err)
+		j.recordFailure(utils.ReduceTaskKind, owner, "", target, err)
+		recoveries++
+		if _, err := j.reassignPartition(owner, target); err != nil {
+			return utils.FinalizeReply{}, err
+		}
+		if j.pullShuffle() {
+			continue // Il nuovo reducer scarica i segmenti prima della chiusura
+		}
+		rebuilt = true
+		if err := j.replayPartition(owner); err != nil {
+			log.Printf("[REDUCE] Ricostruzione della partizione %s fallita: %v\n", owner, err)
+			rebuilt = false
+		}
+	}
+	return utils.FinalizeReply{}, fmt.Errorf("partizione %s non chiusa dopo %d riassegnazioni", owner, maxPartitionRecoveries)
+}
@@ -0,0 +1,182 @@
+package coordinator
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Avvia un server RPC che espone rcvr come "Worker" e ne restituisce l'indirizzo
+func serveWorker(t *testing.T, rcvr interface{}) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := rpc.NewServer()
+	if err := server.RegisterName("Worker", rcvr); err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(listener)
+	return listener.Addr().String()
+}
+
+// Sequenza degli eventi osservati dai worker finti
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *eventLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// Mapper finto: conta i record destinati a ogni partizione e ricorda il tentativo eseguito per chunk
+type recordingMapper struct {
+	log      *eventLog
+	delay    map[int]time.Duration
+	mu       sync.Mutex
+	attempts map[int]string
+}
+
+func (m *recordingMapper) MapTask(req utils.MapRequest, reply *utils.MapReply) error {
+	time.Sleep(m.delay[req.ChunkID])
+	kt, err := utils.GetKeyType(req.KeyType)
+	if err != nil {
+		return err
+	}
+	partitioner, err := utils.NewPartitioner(req.Partition, kt)
+	if err != nil {
+		return err
+	}
+	reply.Sent = make(map[string]int)
+	req.Chunk.Each(func(r utils.Record) error {
+		reply.Sent[req.Partition.Reducers[partitioner.Partition(r.Key)]]++
+		return nil
+	})
+	m.mu.Lock()
+	m.attempts[req.ChunkID] = req.AttemptID
+	m.mu.Unlock()
+	m.log.add("map %d", req.ChunkID)
+	reply.Ack = true
+	return nil
+}
+
+// Reducer finto: chiude la partizione con i record attesi e ne restituisce l'output
+type recordingReducer struct {
+	log      *eventLog
+	delay    time.Duration
+	records  int
+	output   string
+	accepted chan map[int]string
+}
+
+func (r *recordingReducer) FinalizeReduce(req utils.FinalizeRequest, reply *utils.FinalizeReply) error {
+	r.log.add("finalize %s", req.Owner)
+	r.accepted <- req.Accepted
+	time.Sleep(r.delay)
+	reply.Ack = true
+	reply.InputRecords = r.records
+	reply.OutputRecords = r.records
+	return nil
+}
+
+func (r *recordingReducer) FetchOutput(req utils.FetchRequest, reply *utils.FetchReply) error {
+	reply.Data = []byte(r.output[req.Offset:])
+	reply.EOF = true
+	return nil
+}
+
+// La Reduce parte solo dopo che ogni chunk ha un tentativo di Map accettato, riceve i tentativi
+// accettati e l'output finale concatena le partizioni nell'ordine del partizionamento,
+// anche se la prima partizione viene chiusa per ultima
+func TestReduceWaitsForMapAndKeepsPartitionOrder(t *testing.T) {
+	testStore(t)
+	events := &eventLog{}
+
+	mapper := &recordingMapper{log: events, delay: map[int]time.Duration{0: 200 * time.Millisecond}, attempts: make(map[int]string)}
+	first := &recordingReducer{log: events, delay: 200 * time.Millisecond, records: 4, output: "1\n3\n7\n9\n", accepted: make(chan map[int]string, 1)}
+	second := &recordingReducer{log: events, records: 2, output: "12\n15\n", accepted: make(chan map[int]string, 1)}
+	mapperAddr := serveWorker(t, mapper)
+	firstAddr := serveWorker(t, first)
+	secondAddr := serveWorker(t, second)
+
+	m := servingMaster()
+	m.Workers = []utils.WorkerConfig{
+		{Role: "mapper", Address: mapperAddr},
+		{Role: "reducer", Address: firstAddr},
+		{Role: "reducer", Address: secondAddr},
+	}
+	m.scheduler = NewScheduler(nil, m.liveness)
+	job := m.newJob(utils.JobInfo{ID: "job-reduce", Settings: utils.Settings{JobType: "sort", KeyType: "int"}})
+	job.share = m.scheduler.register(job.info)
+	job.outDir = t.TempDir()
+
+	record := func(key string) utils.Record { return utils.Record{Key: key} }
+	chunks := utils.RecordChunks([][]utils.Record{
+		{record("7"), record("1"), record("12")},
+		{record("15"), record("3"), record("9")},
+	})
+	if err := job.store.SaveChunksToFile(chunks); err != nil {
+		t.Fatal(err)
+	}
+	spec := utils.PartitionSpec{Strategy: "range", Reducers: []string{firstAddr, secondAddr}, Bounds: []string{"10"}}
+	if err := job.store.SavePartitionSpec(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Barriera: nessuna chiusura prima della fine di tutti i chunk
+	got := events.snapshot()
+	if len(got) != 4 {
+		t.Fatalf("eventi %v", got)
+	}
+	for i, e := range got {
+		if isMap := strings.HasPrefix(e, "map"); isMap != (i < 2) {
+			t.Fatalf("eventi %v: la Reduce è partita prima della fine della Map", got)
+		}
+	}
+	finalized := []string{got[2], got[3]}
+	sort.Strings(finalized)
+	want := []string{"finalize " + firstAddr, "finalize " + secondAddr}
+	sort.Strings(want)
+	if !equalStrings(finalized, want) {
+		t.Fatalf("partizioni chiuse %v, attese %v", finalized, want)
+	}
+
+	// Il merge considera solo i tentativi accettati
+	for _, r := range []*recordingReducer{first, second} {
+		if accepted := <-r.accepted; !reflect.DeepEqual(accepted, mapper.attempts) {
+			t.Errorf("tentativi passati alla Reduce %v, accettati %v", accepted, mapper.attempts)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(job.outDir, "final_output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != first.output+second.output {
+		t.Errorf("output finale %q, atteso nell'ordine delle partizioni %q", data, first.output+second.output)
+	}
+}
@@ -0,0 +1,339 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"sdcc-mapreduce/utils"
+	"sync"
+	"time"
+)
+
+// Options identifica l'istanza del master nell'elezione del leader
+type Options struct {
+	ID      string // Identità nell'elezione (default MASTER_ID o hostname)
+	Standby bool   // Non prende il controllo di una computazione già conclusa (completed.json)
+}
+
+// Coordina l'intero flusso MapReduce: elezione del leader, generazione dati, assegnazione task, raccolta risultati.
+// Ritorna senza fare nulla se uno standby trova la computazione conclusa.
+func Run(opts Options) {
+
+	/* -------------------------------------------------------------
+		(0) ELEZIONE DEL LEADER E INIZIALIZZAZIONE
+	-------------------------------------------------------------- */
+
+	// Attende di essere l'unico master attivo: lo stato del leader precedente è sullo store condiviso
+	leader := campaign(opts)
+	if leader == nil {
+		return
+	}
+	// Da qui lo stato si scrive solo finché il lease di questo term è valido
+	utils.SetStore(leader.fence(utils.Store()))
+	go leader.keep()
+
+	// Il sistema era stato arrestato a job concluso: l'output dei job resta in output/jobs/
+	if utils.CompletionFlagExists() {
+		utils.RemoveCompletionFlag()
+	}
+
+	// Carica la configurazione dal file config.json
+	config := utils.LoadConfig("config/config.json")
+
+	// Verifica job, chiavi, partizionamento, shuffle e output richiesti
+	if err := validateSettings(config.Settings); err != nil {
+		log.Fatalf("Configurazione non valida: %v", err)
+	}
+
+	// Inizializza il master con i worker configurati
+	master := Master{
+		Workers:  config.Workers,
+		defaults: config.Settings,
+		liveness: NewLiveness(config.Settings.Heartbeat),
+		jobs:     make(map[string]*Job),
+	}
+	master.idle = sync.NewCond(&master.jobMu)
+	master.scheduler = NewScheduler(config.Settings.Scheduler, master.liveness)
+	go master.liveness.Monitor()
+
+	// API HTTP per inviare job, seguirne lo stato e scaricarne l'output
+	go master.ServeAPI()
+
+	// Avvia il server RPC per la registrazione dei worker
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.Register(&master); err != nil {
+		log.Fatalf("Errore nella registrazione RPC del master: %v", err)
+	}
+
+	//fmt.Println("[TEST1] Pausa per kill del master prima della registrazione")
+	//time.Sleep(15 * time.Second)
+
+	// Listener per accettare le connessioni dei worker
+	go func() {
+		listener, err := net.Listen("tcp", ":9000")
+		if err != nil {
+			log.Fatalf("Errore nell'ascolto su porta 9000: %v", err)
+		}
+		log.Println("Master RPC server in ascolto su :9000 per registrazioni")
+		rpcServer.Accept(listener)
+	}()
+
+	/* -------------------------------------------------------------
+		(1) CRASH PRIMA/DOPO REGISTRAZIONE WORKER
+	-------------------------------------------------------------- */
+
+	// Recupera worker da file se esiste
+	if utils.WorkersFileExists() {
+		log.Println("[RECOVERY] Trovato workers.json → recupero worker registrati")
+		workers, err := utils.RecoverWorkersFromFile()
+		checkState(err)
+		master.Workers = workers
+		// I worker recuperati hanno deadAfter di tempo per tornare a inviare heartbeat
+		for _, w := range master.Workers {
+			master.liveness.Beat(w.Address)
+		}
+	}
+
+	// Riprende i job interrotti dal crash, in ordine di invio; i job conclusi tornano nello storico
+	recovered := master.recoverJobs()
+
+	// Con api.serve il master esegue solo i job inviati all'API
+	if master.serving() {
+		log.Println("In attesa di job dall'API HTTP")
+		select {}
+	}
+
+	// Altrimenti esegue il job di config.json (o quello interrotto) e arresta il sistema
+	if recovered == 0 {
+		if _, err := master.submit(utils.JobInfo{ID: newJobID(), Settings: config.Settings, Submitted: time.Now()}); err != nil {
+			log.Fatalf("Errore nell'avvio del job: %v", err)
+		}
+	}
+	master.waitIdle()
+	utils.SaveCompletionFlag()
+	leader.resign()
+}
+
+// Esegue il job fino all'output finale, riprendendo dallo stato salvato
+// dopo un crash del master. Restituisce errJobCanceled se il job viene annullato.
+func runJob(job *Job) error {
+
+	// Tipo delle chiavi: un job.json non valido fa fallire solo questo job
+	kt, err := utils.GetKeyType(job.Settings.KeyType)
+	if err != nil {
+		return job.fatal("%v", err)
+	}
+	job.keys = kt
+
+	/* -------------------------------------------------------------
+		(2) FASE MAP GIA' COMPLETATA
+	-------------------------------------------------------------- */
+
+	mapDone, err := job.store.PhaseAlreadyDone()
+	if err != nil {
+		return job.badState(err)
+	}
+	if mapDone {
+		log.Println("MAP già completata. Passo alla fase di Reduce.")
+		saved, _, err := job.store.LoadPartitionSpec()
+		if err != nil {
+			return job.badState(err)
+		}
+		job.setPartitioning(saved)
+		return finishJob(job)
+	}
+
+	/* -------------------------------------------------------------
+		(3) CRASH CON FASE MAP INIZIATA E CHUNK PENDENTI
+	-------------------------------------------------------------- */
+	if job.store.StateFilesExist() {
+		log.Println("[STATE] status.json esiste. Provo a recuperare i chunk pending...")
+
+		all, err := job.store.LoadChunksFromFile()
+		if err != nil {
+			return job.badState(err)
+		}
+		chunks, err := job.store.RecoverPendingChunks()
+		if err != nil {
+			return job.badState(err)
+		}
+
+		if len(chunks) > 0 {
+			log.Printf("[RECOVERY] Avvio fase MAP con %d chunk pending\n", len(chunks))
+			if err := job.LoadOrComputePartitioning(all); err != nil {
+				return job.fatal("%v", err)
+			}
+			if err := runMapPhase(job, chunks); err != nil {
+				return err
+			}
+			return finishJob(job)
+		}
+
+		log.Println("[RECOVERY] Nessun chunk pending trovato. Passo a generazione nuova.")
+	}
+
+	/* -------------------------------------------------------------
+		(4) CRASH DOPO GENERAZIONE DATI
+	-------------------------------------------------------------- */
+
+	if job.store.DataFileExists() {
+		log.Println("[RECOVERY] Trovato solo data.json. Rilancio split.")
+		data, err := job.store.LoadDataFromFile()
+		if err != nil {
+			return job.badState(err)
+		}
+		chunks := job.SplitData(data)
+		if err := job.prepareChunks(chunks); err != nil {
+			return job.fatal("%v", err)
+		}
+		if err := runMapPhase(job, utils.IndexChunks(chunks)); err != nil {
+			return err
+		}
+		return finishJob(job)
+	}
+
+	/* -------------------------------------------------------------
+		(5) CRASH DOPO GENERAZIONE CHUNK
+	-------------------------------------------------------------- */
+	if job.store.ChunkFileExists() {
+		log.Println("[RECOVERY] Trovato solo chunk.json.")
+		chunks, err := job.store.LoadChunksFromFile()
+		if err != nil {
+			return job.badState(err)
+		}
+		if err := job.prepareChunks(chunks); err != nil {
+			return job.fatal("%v", err)
+		}
+		if err := runMapPhase(job, utils.IndexChunks(chunks)); err != nil {
+			return err
+		}
+		return finishJob(job)
+	}
+
+	/* -------------------------------------------------------------
+		(6) GENERAZIONE DA ZERO
+	-------------------------------------------------------------- */
+
+	if err := job.WaitForWorkers(job.Settings.NumMappers, job.Settings.NumReducers); err != nil {
+		return job.fatal("%v", err)
+	}
+	utils.SaveWorkerOnRegister(job.registeredWorkers())
+
+	//fmt.Println("[TEST2] Pausa per kill del master dopo la registrazione ma prima della generazione dei dati")
+	//time.Sleep(15 * time.Second)
+
+	// I dati generati non passano da data.json: i chunk contengono solo seed e dimensioni
+	var chunks []utils.ChunkData
+	if job.generatedInput() {
+		chunks = job.GenerateData(job.Settings.Count, job.Settings.Xi, job.Settings.Xf)
+	} else {
+		data, err := job.LoadInput()
+		if err != nil {
+			return job.fatal("Errore caricamento input: %v", err)
+		}
+		if err := job.store.SaveDataToFile(data); err != nil {
+			return job.fatal("%v", err)
+		}
+
+		//fmt.Println("[TEST3] Pausa per kill del master dopo generazione dati ma prima dello split in chunk")
+		//time.Sleep(15 * time.Second)
+
+		chunks = job.SplitData(data)
+	}
+	if err := job.prepareChunks(chunks); err != nil {
+		return job.fatal("%v", err)
+	}
+
+	//fmt.Println("[TEST4] Pausa per kill del master prima di ExecuteMapPhase")
+	//time.Sleep(15 * time.Second)
+
+	if err := runMapPhase(job, utils.IndexChunks(chunks)); err != nil {
+		return err
+	}
+
+	//fmt.Println("[TEST5] Pausa per kill del master dopo di ExecuteMapPhase")
+	//time.Sleep(15 * time.Second)
+
+	return finishJob(job)
+}
+
+// Salva chunk e tabella dei task e prepara il partizionamento, prima della fase di Map
+func (j *Job) prepareChunks(chunks []utils.ChunkData) error {
+	if err := j.store.SaveChunksToFile(chunks); err != nil {
+		return err
+	}
+	if err := j.store.InitStatusFile(len(chunks)); err != nil {
+		return err
+	}
+	return j.LoadOrComputePartitioning(chunks)
+}
+
+// Interrompe il recovery del master se un file di stato è corrotto o illeggibile:
+// ripartire da uno stato sbagliato rischierebbe di perdere o duplicare chunk
+func checkState(err error) {
+	if err != nil {
+		log.Fatalf("[RECOVERY] Stato non valido, intervento manuale richiesto: %v", err)
+	}
+}
+
+// Come checkState per lo stato di un job: fallisce solo il job
+func (j *Job) badState(err error) error {
+	return j.fatal("[RECOVERY] Stato del job non valido, intervento manuale richiesto: %v", err)
+}
+
+// Esegue la fase di Map e si ferma se qualche chunk non è stato completato:
+// la Reduce parte solo quando tutti i chunk sono "done" (al riavvio si riprendono i pending)
+func runMapPhase(job *Job, chunks []utils.Chunk) error {
+	if err := job.ExecuteMapPhase(chunks); err != nil {
+		if errors.Is(err, errJobCanceled) {
+			return err
+		}
+		return job.fatal("[MAP] Fase di Map non completata, Reduce non avviata: %v", err)
+	}
+	return nil
+}
+
+// Esegue la fase di Reduce e unisce l'output
+func finishJob(job *Job) error {
+	if err := job.ExecuteReducePhase(); err != nil {
+		if errors.Is(err, errJobCanceled) {
+			return err
+		}
+		return job.fatal("[REDUCE] Fase di Reduce non completata, Combine non avviato: %v", err)
+	}
+	if err := job.CombineOutputFiles(); err != nil {
+		return job.fatal("Errore nella scrittura dell'output finale: %v", err)
+	}
+	return nil
+}
+
+// Verifica che job, tipo delle chiavi, partizionamento, shuffle, input, output e scheduling delle impostazioni siano validi
+func validateSettings(settings utils.Settings) error {
+	job, err := utils.GetJob(settings.JobType)
+	if err != nil {
+		return fmt.Errorf("%v (disponibili: %v)", err, utils.JobTypes())
+	}
+	keyType, err := utils.GetKeyType(settings.KeyType)
+	if err != nil {
+		return fmt.Errorf("%v (disponibili: %v)", err, utils.KeyTypeNames())
+	}
+	if err := validatePartitioner(settings, keyType, job); err != nil {
+		return fmt.Errorf("%v (disponibili: %v)", err, partitionerChoices())
+	}
+	if !utils.ValidShuffle(settings.Shuffle) {
+		return fmt.Errorf("shuffle %q (disponibili: %s, %s)", settings.Shuffle, utils.PushShuffle, utils.PullShuffle)
+	}
+	if settings.Input != nil {
+		if err := settings.Input.Validate(); err != nil {
+			return err
+		}
+	}
+	if settings.Output != nil {
+		if err := settings.Output.Validate(); err != nil {
+			return err
+		}
+	}
+	return validateScheduling(settings)
+}
@@ -0,0 +1,94 @@
+package coordinator
+
+import (
+	"errors"
+	"sdcc-mapreduce/utils"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Store locale vuoto per il test, ripristinato a fine test
+func testStore(t *testing.T) utils.StateStore {
+	t.Helper()
+	prev := utils.Store()
+	t.Cleanup(func() { utils.SetStore(prev) })
+	store := &utils.LocalStore{Root: t.TempDir()}
+	utils.SetStore(store)
+	return store
+}
+
+// Store che rifiuta ogni scrittura (es. disco pieno o S3 non raggiungibile)
+type readOnlyStore struct {
+	utils.StateStore
+}
+
+var errReadOnly = errors.New("store in sola lettura")
+
+func (readOnlyStore) Put(key string, data []byte) error { return errReadOnly }
+
+func (readOnlyStore) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	return false, errReadOnly
+}
+
+// Master che esegue i job dell'API: un job che fallisce non arresta il master
+func servingMaster() *Master {
+	return &Master{defaults: utils.Settings{API: &utils.APIConfig{Serve: true}}, liveness: NewLiveness(nil)}
+}
+
+// Stato corrotto, tipo delle chiavi sconosciuto o store non scrivibile fanno fallire solo il job
+func TestRunJobErrorsFailOnlyTheJob(t *testing.T) {
+	settings := utils.Settings{JobType: "sort", KeyType: "int"}
+
+	t.Run("stato corrotto", func(t *testing.T) {
+		store := testStore(t)
+		if err := store.Put("state/jobs/j1/status.json", []byte("{")); err != nil {
+			t.Fatal(err)
+		}
+		job := servingMaster().newJob(utils.JobInfo{ID: "j1", Settings: settings})
+		if err := runJob(job); err == nil {
+			t.Error("job con status.json corrotto eseguito")
+		}
+	})
+
+	t.Run("tipo delle chiavi", func(t *testing.T) {
+		testStore(t)
+		job := servingMaster().newJob(utils.JobInfo{ID: "j2", Settings: utils.Settings{JobType: "sort", KeyType: "uuid"}})
+		if err := runJob(job); err == nil {
+			t.Error("job con tipo delle chiavi sconosciuto eseguito")
+		}
+	})
+
+	t.Run("scrittura dello stato", func(t *testing.T) {
+		store := testStore(t)
+		if err := utils.NewJobState("j3").SaveChunksToFile(utils.RecordChunks([][]utils.Record{utils.IntsToRecords([]int{1})})); err != nil {
+			t.Fatal(err)
+		}
+		utils.SetStore(readOnlyStore{store})
+		job := servingMaster().newJob(utils.JobInfo{ID: "j3", Settings: settings})
+		if err := runJob(job); err == nil || !strings.Contains(err.Error(), errReadOnly.Error()) {
+			t.Errorf("errore di scrittura dello stato: %v", err)
+		}
+	})
+}
+
+// I job leggono i worker mentre Register li aggiunge (go test -race)
+func TestRegisteredWorkersConcurrentRegister(t *testing.T) {
+	m := servingMaster()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			var ok bool
+			m.Register(utils.WorkerConfig{Role: "mapper", Address: "m" + strconv.Itoa(i) + ":9001"}, &ok)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		m.getMappers()
+		m.registeredWorkers()
+	}
+	<-done
+	if _, n := m.getMappers(); n != 100 {
+		t.Errorf("%d mapper registrati, attesi 100", n)
+	}
+}
@@ -0,0 +1,374 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sdcc-mapreduce/utils"
+	"sync"
+	"time"
+)
+
+// ========================================================================================
+// Scheduler: divisione degli slot di mapper e reducer tra i job in esecuzione
+// ========================================================================================
+
+// Ogni worker offre un numero fisso di slot (settings.scheduler.mapSlots/reduceSlots). Un task
+// occupa uno slot per tutta l'esecuzione; quando uno slot si libera va alla richiesta in attesa
+// del job scelto dalla politica:
+//   - fair: il job con meno slot in uso rispetto al peso (settings.weight)
+//   - priority: il job con priorità più alta (settings.priority), a parità come fair
+//   - fifo: il job inviato per primo
+
+// Ogni quanto una richiesta in attesa verifica di avere ancora worker vivi a cui essere assegnata
+const slotRecheck = time.Second
+
+// Restituito quando nessun worker vivo, tra quelli ammessi dalla richiesta, può ricevere il task
+var errNoSlot = errors.New("nessun worker disponibile")
+
+// Scheduler assegna gli slot dei worker ai job
+type Scheduler struct {
+	policy      string
+	mapSlots    int
+	reduceSlots int
+	liveness    *Liveness
+
+	mu      sync.Mutex
+	inUse   map[string]int // Slot occupati per worker
+	jobs    map[*jobShare]bool
+	waiting []*slotRequest
+	seq     int
+}
+
+// jobShare è la parte di un job nello scheduler: identità, priorità, peso e contatori
+type jobShare struct {
+	sched     *Scheduler
+	id        string
+	priority  int
+	weight    int
+	submitted time.Time
+
+	// Protetti da Scheduler.mu
+	running  map[string]int // Slot in uso per ruolo (mapper/reducer)
+	waiting  int
+	granted  int
+	waited   time.Duration
+	decision string
+}
+
+// Richiesta di uno slot da parte di un task
+type slotRequest struct {
+	job     *jobShare
+	role    string
+	workers []string    // Worker ammessi, in ordine di preferenza
+	grant   chan string // Riceve il worker assegnato
+	granted string
+	since   time.Time
+	seq     int
+}
+
+// Crea lo scheduler secondo settings.scheduler
+func NewScheduler(cfg *utils.SchedulerConfig, liveness *Liveness) *Scheduler {
+	s := &Scheduler{
+		policy:      utils.FairScheduling,
+		mapSlots:    1,
+		reduceSlots: 1,
+		liveness:    liveness,
+		inUse:       make(map[string]int),
+		jobs:        make(map[*jobShare]bool),
+	}
+	if cfg != nil {
+		if cfg.Policy != "" {
+			s.policy = cfg.Policy
+		}
+		if cfg.MapSlots > 0 {
+			s.mapSlots = cfg.MapSlots
+		}
+		if cfg.ReduceSlots > 0 {
+			s.reduceSlots = cfg.ReduceSlots
+		}
+	}
+	return s
+}
+
+// Verifica politica dello scheduler e peso del job
+func validateScheduling(settings utils.Settings) error {
+	if cfg := settings.Scheduler; cfg != nil {
+		switch cfg.Policy {
+		case "", utils.FairScheduling, utils.PriorityScheduling, utils.FIFOScheduling:
+		default:
+			return fmt.Errorf("politica dello scheduler %q (disponibili: %s, %s, %s)", cfg.Policy, utils.FairScheduling, utils.PriorityScheduling, utils.FIFOScheduling)
+		}
+	}
+	if settings.Weight < 0 {
+		return fmt.Errorf("peso del job negativo: %d", settings.Weight)
+	}
+	return nil
+}
+
+// Peso del job (default 1)
+func jobWeight(settings utils.Settings) int {
+	if settings.Weight > 0 {
+		return settings.Weight
+	}
+	return 1
+}
+
+// Registra un job che inizia l'esecuzione
+func (s *Scheduler) register(info utils.JobInfo) *jobShare {
+	share := &jobShare{
+		sched:     s,
+		id:        info.ID,
+		priority:  info.Settings.Priority,
+		weight:    jobWeight(info.Settings),
+		submitted: info.Submitted,
+		running:   make(map[string]int),
+	}
+	s.mu.Lock()
+	s.jobs[share] = true
+	s.mu.Unlock()
+	return share
+}
+
+// Rimuove il job concluso e ne restituisce le statistiche finali. Gli slot ancora occupati da
+// tentativi abbandonati vengono liberati normalmente al loro termine.
+func (s *Scheduler) unregister(share *jobShare) *utils.SchedulingStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statusLocked(share)
+	delete(s.jobs, share)
+	status.Share = 0
+	return status
+}
+
+// Stato del job nello scheduler
+func (s *Scheduler) status(share *jobShare) *utils.SchedulingStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked(share)
+}
+
+func (s *Scheduler) statusLocked(share *jobShare) *utils.SchedulingStatus {
+	waited := share.waited
+	for _, req := range s.waiting {
+		if req.job == share {
+			waited += time.Since(req.since)
+		}
+	}
+	return &utils.SchedulingStatus{
+		Policy:       s.policy,
+		Priority:     share.priority,
+		Weight:       share.weight,
+		Share:        s.shareLocked(share),
+		MapSlots:     share.running["mapper"],
+		ReduceSlots:  share.running["reducer"],
+		Waiting:      share.waiting,
+		Granted:      share.granted,
+		WaitMs:       waited.Milliseconds(),
+		LastDecision: share.decision,
+	}
+}
+
+// Quota di slot spettante al job tra quelli in esecuzione
+func (s *Scheduler) shareLocked(share *jobShare) float64 {
+	if s.policy == utils.FIFOScheduling {
+		return 0
+	}
+	top := share.priority
+	if s.policy == utils.PriorityScheduling {
+		for other := range s.jobs {
+			if other.priority > top {
+				return 0
+			}
+		}
+	}
+	total := 0
+	for other := range s.jobs {
+		if s.policy != utils.PriorityScheduling || other.priority == top {
+			total += other.weight
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(share.weight) / float64(total)
+}
+
+// Slot offerti da un worker del ruolo indicato
+func (s *Scheduler) capacity(role string) int {
+	if role == "reducer" {
+		return s.reduceSlots
+	}
+	return s.mapSlots
+}
+
+// Attende uno slot su uno dei worker del ruolo indicato, esclusi quelli in skip.
+// Restituisce errNoSlot se nessuno dei worker ammessi è vivo, errJobCanceled se cancel viene chiuso.
+func (share *jobShare) acquire(role string, workers []utils.WorkerConfig, skip map[string]bool, cancel <-chan struct{}) (string, error) {
+	s := share.sched
+	req := &slotRequest{job: share, role: role, grant: make(chan string, 1), since: time.Now()}
+	for _, w := range workers {
+		if !skip[w.Address] {
+			req.workers = append(req.workers, w.Address)
+		}
+	}
+
+	s.mu.Lock()
+	if !s.anyAliveLocked(req) {
+		s.mu.Unlock()
+		return "", errNoSlot
+	}
+	s.seq++
+	req.seq = s.seq
+	s.waiting = append(s.waiting, req)
+	share.waiting++
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(slotRecheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case addr := <-req.grant:
+			return addr, nil
+		case <-cancel:
+			return "", s.withdraw(req, errJobCanceled)
+		case <-ticker.C:
+			s.mu.Lock()
+			alive := s.anyAliveLocked(req)
+			s.mu.Unlock()
+			if !alive {
+				return "", s.withdraw(req, errNoSlot)
+			}
+		}
+	}
+}
+
+// Attende uno slot su un worker preciso (es. il reducer che ospita una partizione)
+func (share *jobShare) acquireOn(role, addr string, cancel <-chan struct{}) error {
+	_, err := share.acquire(role, []utils.WorkerConfig{{Role: role, Address: addr}}, nil, cancel)
+	return err
+}
+
+// Libera lo slot occupato sul worker
+func (share *jobShare) release(role, addr string) {
+	s := share.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inUse[addr]--
+	share.running[role]--
+	s.dispatchLocked()
+}
+
+// Ritira una richiesta in attesa; se nel frattempo è stata soddisfatta libera lo slot
+func (s *Scheduler) withdraw(req *slotRequest, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.granted != "" {
+		s.inUse[req.granted]--
+		req.job.running[req.role]--
+		s.dispatchLocked()
+		return err
+	}
+	for i, w := range s.waiting {
+		if w == req {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			break
+		}
+	}
+	req.job.waiting--
+	req.job.waited += time.Since(req.since)
+	return err
+}
+
+// Indica se almeno un worker ammesso dalla richiesta è vivo
+func (s *Scheduler) anyAliveLocked(req *slotRequest) bool {
+	for _, addr := range req.workers {
+		if !s.liveness.IsDead(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Worker vivo con uno slot libero per la richiesta, il meno carico ("" se non ce ne sono)
+func (s *Scheduler) freeWorkerLocked(req *slotRequest) string {
+	best := ""
+	for _, addr := range req.workers {
+		if s.inUse[addr] >= s.capacity(req.role) || s.liveness.IsDead(addr) {
+			continue
+		}
+		if best == "" || s.inUse[addr] < s.inUse[best] {
+			best = addr
+		}
+	}
+	return best
+}
+
+// Indica se la richiesta a va servita prima di b secondo la politica; a parità vale l'ordine di arrivo
+func (s *Scheduler) before(a, b *slotRequest) bool {
+	ja, jb := a.job, b.job
+	if ja != jb {
+		if s.policy == utils.PriorityScheduling && ja.priority != jb.priority {
+			return ja.priority > jb.priority
+		}
+		if s.policy != utils.FIFOScheduling {
+			// Slot in uso rispetto al peso: ra/wa < rb/wb
+			ua, ub := ja.running[a.role]*jb.weight, jb.running[b.role]*ja.weight
+			if ua != ub {
+				return ua < ub
+			}
+			if ja.priority != jb.priority {
+				return ja.priority > jb.priority
+			}
+		}
+		if !ja.submitted.Equal(jb.submitted) {
+			return ja.submitted.Before(jb.submitted)
+		}
+	}
+	return a.seq < b.seq
+}
+
+// Assegna gli slot liberi alle richieste in attesa, una alla volta secondo la politica
+func (s *Scheduler) dispatchLocked() {
+	for {
+		best := -1
+		for i, req := range s.waiting {
+			if s.freeWorkerLocked(req) == "" {
+				continue
+			}
+			if best < 0 || s.before(req, s.waiting[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return
+		}
+
+		req := s.waiting[best]
+		s.waiting = append(s.waiting[:best], s.waiting[best+1:]...)
+		addr := s.freeWorkerLocked(req)
+		others := 0
+		for _, w := range s.waiting {
+			if w.job != req.job && w.role == req.role {
+				others++
+			}
+		}
+
+		job := req.job
+		s.inUse[addr]++
+		job.running[req.role]++
+		job.waiting--
+		job.granted++
+		job.waited += time.Since(req.since)
+		job.decision = fmt.Sprintf("%s: slot di %s (%s) dopo %v di attesa; politica %s, %d slot %s in uso con peso %d e priorità %d, %d richieste di altri job in attesa",
+			time.Now().Format(time.TimeOnly), addr, req.role, time.Since(req.since).Round(time.Millisecond), s.policy,
+			job.running[req.role], req.role, job.weight, job.priority, others)
+		if others > 0 {
+			log.Printf("[SCHED] Job %s: %s\n", job.id, job.decision)
+		}
+
+		req.granted = addr
+		req.grant <- addr
+	}
+}
@@ -0,0 +1,197 @@
+package coordinator
+
+import (
+	"sdcc-mapreduce/utils"
+	"testing"
+	"time"
+)
+
+// Worker di ruolo mapper con gli indirizzi indicati
+func mappers(addrs ...string) []utils.WorkerConfig {
+	workers := make([]utils.WorkerConfig, len(addrs))
+	for i, addr := range addrs {
+		workers[i] = utils.WorkerConfig{Role: "mapper", Address: addr}
+	}
+	return workers
+}
+
+// Registra un job nello scheduler con priorità, peso e ordine di invio
+func testShare(s *Scheduler, id string, priority, weight int, submitted time.Time) *jobShare {
+	return s.register(utils.JobInfo{ID: id, Submitted: submitted, Settings: utils.Settings{Priority: priority, Weight: weight}})
+}
+
+// Attende (al massimo un secondo) che la condizione sia vera
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout: %s", what)
+		}
+	}
+}
+
+// Slot assegnato a una richiesta in attesa
+type testGrant struct {
+	job  string
+	addr string
+}
+
+// Accoda una richiesta di slot e attende che sia in coda; l'assegnazione arriva su grants
+func queue(t *testing.T, share *jobShare, workers []utils.WorkerConfig, grants chan<- testGrant) {
+	t.Helper()
+	before := share.sched.status(share).Waiting
+	go func() {
+		addr, err := share.acquire("mapper", workers, nil, nil)
+		if err != nil {
+			t.Errorf("job %s: %v", share.id, err)
+		}
+		grants <- testGrant{share.id, addr}
+	}()
+	eventually(t, "richiesta del job "+share.id+" in coda", func() bool {
+		return share.sched.status(share).Waiting > before
+	})
+}
+
+// Slot liberati uno alla volta: i job li ricevono in proporzione al peso
+func TestSchedulerFairWeights(t *testing.T) {
+	s := NewScheduler(nil, NewLiveness(nil))
+	workers := mappers("m1:9001", "m2:9001", "m3:9001")
+	now := time.Now()
+	filler := testShare(s, "filler", 0, 1, now)
+	heavy := testShare(s, "heavy", 0, 2, now.Add(time.Second))
+	light := testShare(s, "light", 0, 1, now.Add(2*time.Second))
+
+	var held []string
+	for range workers {
+		addr, err := filler.acquire("mapper", workers, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, addr)
+	}
+
+	grants := make(chan testGrant, 6)
+	for i := 0; i < 3; i++ {
+		queue(t, heavy, workers, grants)
+		queue(t, light, workers, grants)
+	}
+	var order []string
+	for _, addr := range held {
+		filler.release("mapper", addr)
+		order = append(order, (<-grants).job)
+	}
+	if want := []string{"heavy", "light", "heavy"}; !equalStrings(order, want) {
+		t.Errorf("slot assegnati a %v, atteso %v", order, want)
+	}
+
+	s.unregister(filler)
+	if got := s.status(heavy); got.MapSlots != 2 || got.Share < 0.66 || got.Share > 0.67 {
+		t.Errorf("heavy: %d slot, quota %.2f; attesi 2 slot e quota 2/3", got.MapSlots, got.Share)
+	}
+	if got := s.status(light); got.MapSlots != 1 || got.Waiting != 2 {
+		t.Errorf("light: %d slot, %d in attesa; attesi 1 e 2", got.MapSlots, got.Waiting)
+	}
+}
+
+// Con la politica priority lo slot liberato va al job più prioritario anche se ha chiesto dopo
+func TestSchedulerPriorityPreemptsWaitingJobs(t *testing.T) {
+	s := NewScheduler(&utils.SchedulerConfig{Policy: utils.PriorityScheduling}, NewLiveness(nil))
+	workers := mappers("m1:9001")
+	now := time.Now()
+	low := testShare(s, "low", 0, 5, now)
+	high := testShare(s, "high", 10, 1, now.Add(time.Second))
+
+	addr, err := low.acquire("mapper", workers, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants := make(chan testGrant, 2)
+	queue(t, low, workers, grants)
+	queue(t, high, workers, grants)
+	if share := s.status(low).Share; share != 0 {
+		t.Errorf("quota del job meno prioritario %.2f, attesa 0", share)
+	}
+
+	low.release("mapper", addr)
+	if got := <-grants; got.job != "high" {
+		t.Fatalf("slot assegnato a %s, atteso high", got.job)
+	}
+	high.release("mapper", addr)
+	if got := <-grants; got.job != "low" {
+		t.Errorf("slot assegnato a %s, atteso low", got.job)
+	}
+}
+
+// Con la politica fifo conta l'ordine di invio del job, non quello delle richieste
+func TestSchedulerFIFO(t *testing.T) {
+	s := NewScheduler(&utils.SchedulerConfig{Policy: utils.FIFOScheduling}, NewLiveness(nil))
+	workers := mappers("m1:9001")
+	now := time.Now()
+	first := testShare(s, "first", 0, 1, now)
+	second := testShare(s, "second", 10, 10, now.Add(time.Second))
+
+	addr, err := second.acquire("mapper", workers, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants := make(chan testGrant, 2)
+	queue(t, second, workers, grants)
+	queue(t, first, workers, grants)
+
+	second.release("mapper", addr)
+	if got := <-grants; got.job != "first" {
+		t.Errorf("slot assegnato a %s, atteso first", got.job)
+	}
+	first.release("mapper", addr)
+	<-grants
+}
+
+// Una richiesta annullata lascia la coda; un worker morto non riceve richieste
+func TestSchedulerCancelAndDeadWorkers(t *testing.T) {
+	live := NewLiveness(nil)
+	s := NewScheduler(nil, live)
+	workers := mappers("m1:9001")
+	job := testShare(s, "job", 0, 1, time.Now())
+
+	addr, err := job.acquire("mapper", workers, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := job.acquire("mapper", workers, nil, cancel)
+		done <- err
+	}()
+	eventually(t, "richiesta in coda", func() bool { return s.status(job).Waiting == 1 })
+	close(cancel)
+	if err := <-done; err != errJobCanceled {
+		t.Fatalf("richiesta annullata: %v", err)
+	}
+	job.release("mapper", addr)
+	if got := s.status(job); got.Waiting != 0 || got.MapSlots != 0 {
+		t.Errorf("dopo l'annullamento: %d in attesa, %d slot; attesi 0", got.Waiting, got.MapSlots)
+	}
+
+	live.Beat("r1:9002")
+	live.evaluate(time.Now().Add(time.Minute))
+	if err := job.acquireOn("reducer", "r1:9002", nil); err != errNoSlot {
+		t.Errorf("slot su un reducer morto: %v", err)
+	}
+	skip := map[string]bool{"m1:9001": true}
+	if _, err := job.acquire("mapper", workers, skip, nil); err != errNoSlot {
+		t.Errorf("slot senza worker ammessi: %v", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sdcc-mapreduce/utils"
+)
+
+// ========================================================================================
+// Shuffle pull: i reducer scaricano dai mapper i segmenti delle proprie partizioni
+// ========================================================================================
+
+// Download di una partizione: dopo il primo tentativo i chunk con segmenti mancanti vengono rieseguiti
+const maxPullRounds = 2
+
+// Segmenti di una partizione non recuperabili nemmeno rieseguendo i chunk: non dipende dal reducer
+var errShuffleLost = errors.New("segmenti dello shuffle non disponibili")
+
+// Indica se il job usa lo shuffle pull
+func (j *Job) pullShuffle() bool {
+	return j.Settings.Shuffle == utils.PullShuffle
+}
+
+// Indica al reducer target quali mapper conservano i segmenti della partizione dell'Owner e attende
+// che li scarichi. Un reducer riavviato scarica di nuovo solo i segmenti persi, senza rieseguire
+// la Map; i chunk il cui mapper non fornisce più il segmento vengono rieseguiti per questa partizione.
+// Restituisce errShuffleLost se i segmenti restano introvabili, un altro errore se il reducer non risponde.
+func (j *Job) pullPartition(owner, target string) error {
+	logPrefix := fmt.Sprintf("PULL-%s", owner)
+	for round := 1; ; round++ {
+		sources, err := j.store.LoadPartitionSegments(owner)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errShuffleLost, err)
+		}
+
+		req := utils.PullPartitionRequest{JobID: j.info.ID, Owner: owner, Sources: sources}
+		var reply utils.PullPartitionReply
+		if err := CallWithRetry(target, "Worker.PullPartition", req, &reply, logPrefix, "partizione "+owner); err != nil {
+			return err
+		}
+		if len(reply.Missing) == 0 {
+			log.Printf("[SHUFFLE] Partizione %s su %s: %d segmenti scaricati, %d già presenti\n", owner, target, reply.Fetched, reply.Skipped)
+			return nil
+		}
+		if round == maxPullRounds {
+			return fmt.Errorf("%w: chunk %v", errShuffleLost, reply.Missing)
+		}
+
+		// I mapper che conservavano questi segmenti non rispondono: rigenera i segmenti altrove
+		log.Printf("[SHUFFLE] Segmenti dei chunk %v per la partizione %s non disponibili: rieseguo i chunk\n", reply.Missing, owner)
+		attempts := make(map[int]string)
+		for _, src := range sources {
+			attempts[src.ChunkID] = src.AttemptID
+		}
+		missing := make(map[int]string, len(reply.Missing))
+		for _, id := range reply.Missing {
+			missing[id] = attempts[id]
+		}
+		if err := j.rerunChunks(owner, missing); err != nil {
+			return fmt.Errorf("%w: %v", errShuffleLost, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package coordinator
+
+import (
+	"log"
+	"sdcc-mapreduce/utils"
+	"sort"
+	"time"
+)
+
+// ========================================================================================
+// Esecuzione speculativa dei chunk lenti
+// ========================================================================================
+
+// Parametri effettivi della speculazione (default per i valori non configurati)
+type speculationPolicy struct {
+	threshold  float64       // Frazione di chunk completati oltre cui si valutano i backup
+	slowFactor float64       // Un chunk è lento se dura più di slowFactor × mediana
+	minRuntime time.Duration // Durata minima prima di lanciare un backup
+	interval   time.Duration // Frequenza dei controlli
+}
+
+func newSpeculationPolicy(cfg *utils.SpeculationConfig) speculationPolicy {
+	policy := speculationPolicy{
+		threshold:  0.75,
+		slowFactor: 2,
+		minRuntime: 2 * time.Second,
+		interval:   1 * time.Second,
+	}
+	if cfg.Threshold > 0 && cfg.Threshold <= 1 {
+		policy.threshold = cfg.Threshold
+	}
+	if cfg.SlowFactor > 1 {
+		policy.slowFactor = cfg.SlowFactor
+	}
+	if cfg.MinRuntimeMs > 0 {
+		policy.minRuntime = time.Duration(cfg.MinRuntimeMs) * time.Millisecond
+	}
+	return policy
+}
+
+// Controlla periodicamente i chunk in corso e lancia un backup per quelli lenti
+func (p *mapPhase) speculate(policy speculationPolicy, stop <-chan struct{}) {
+	ticker := time.NewTicker(policy.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, task := range p.stragglers(policy, time.Now()) {
+			log.Printf("[SPECULATIVE] Chunk %d in corso da %v: lancio un tentativo di backup\n",
+				task.chunk.ID, time.Since(task.start).Round(time.Millisecond))
+			p.start(task)
+		}
+	}
+}
+
+// Restituisce i chunk da duplicare, marcandoli come già dotati di backup. Il backup viene
+// conteggiato in running sotto lo stesso lock: se nel frattempo il tentativo originale fallisce
+// non chiude task.finished, che verrà chiuso una sola volta dal backup.
+func (p *mapPhase) stragglers(policy speculationPolicy, now time.Time) []*mapTask {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := len(p.tasks)
+	completed := len(p.durations)
+	if total == 0 || completed == total || float64(completed) < policy.threshold*float64(total) {
+		return nil
+	}
+
+	limit := time.Duration(policy.slowFactor * float64(median(p.durations)))
+	if limit < policy.minRuntime {
+		limit = policy.minRuntime
+	}
+
+	var slow []*mapTask
+	for _, task := range p.tasks {
+		if task.done || task.failed || task.backup || task.running == 0 {
+			continue
+		}
+		if now.Sub(task.start) > limit {
+			task.backup = true
+			task.running++
+			slow = append(slow, task)
+		}
+	}
+	return slow
+}
+
+// Mediana di una lista di durate (non vuota)
+func median(durations []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,36 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStragglersCountBackupAttempt(t *testing.T) {
+	now := time.Now()
+	slow := &mapTask{start: now.Add(-10 * time.Second), running: 1, finished: make(chan struct{})}
+	fast := &mapTask{start: now.Add(-time.Second), running: 1, finished: make(chan struct{})}
+	p := &mapPhase{
+		tasks:     []*mapTask{{done: true}, {done: true}, {done: true}, slow, fast},
+		durations: []time.Duration{time.Second, time.Second, 2 * time.Second},
+	}
+	policy := speculationPolicy{threshold: 0.5, slowFactor: 2, minRuntime: 2 * time.Second}
+
+	got := p.stragglers(policy, now)
+	if len(got) != 1 || got[0] != slow {
+		t.Fatalf("stragglers = %v, atteso solo il chunk lento", got)
+	}
+	// Il backup è già conteggiato: un fallimento dell'originale non chiude il chunk
+	if !slow.backup || slow.running != 2 {
+		t.Fatalf("backup = %v, running = %d; attesi true, 2", slow.backup, slow.running)
+	}
+	if again := p.stragglers(policy, now); len(again) != 0 {
+		t.Errorf("secondo backup per lo stesso chunk: %v", again)
+	}
+
+	// Sotto la soglia di chunk completati non si specula
+	p.durations = p.durations[:1]
+	fast.start = now.Add(-time.Minute)
+	if early := p.stragglers(policy, now); len(early) != 0 {
+		t.Errorf("backup prima della soglia: %v", early)
+	}
+}
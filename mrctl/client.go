@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"strconv"
+	"time"
+)
+
+// ========================================================================================
+// Client dell'API HTTP del master
+// ========================================================================================
+
+// Client invia le richieste all'API del master
+type Client struct {
+	Base  string // Indirizzo dell'API, es. http://localhost:8080
+	Token string // Token dell'API (api.token del master), vuoto se non richiesto
+	HTTP  *http.Client
+}
+
+func NewClient(base string) *Client {
+	return &Client{Base: base, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Esegue una richiesta e decodifica la risposta JSON in out; le risposte di errore
+// dell'API diventano errori con il messaggio restituito dal master
+func (c *Client) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.Base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("master non raggiungibile: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Aggiunge il token dell'API alla richiesta
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+// Errore contenuto in una risposta dell'API
+func responseError(resp *http.Response) error {
+	var apiErr utils.APIError
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+		return fmt.Errorf("risposta %s dal master", resp.Status)
+	}
+	return fmt.Errorf("%s", apiErr.Error)
+}
+
+// Invia un job con le impostazioni indicate (stessa forma di settings in config.json)
+func (c *Client) Submit(settings map[string]interface{}) (utils.JobStatus, error) {
+	var status utils.JobStatus
+	err := c.do(http.MethodPost, "/jobs", settings, &status)
+	return status, err
+}
+
+// Job in corso o ultimo job concluso
+func (c *Client) Jobs() ([]utils.JobStatus, error) {
+	var jobs []utils.JobStatus
+	err := c.do(http.MethodGet, "/jobs", nil, &jobs)
+	return jobs, err
+}
+
+// Stato e avanzamento di un job
+func (c *Client) Job(id string) (utils.JobStatus, error) {
+	var status utils.JobStatus
+	err := c.do(http.MethodGet, "/jobs/"+url.PathEscape(id), nil, &status)
+	return status, err
+}
+
+// Annulla un job
+func (c *Client) Cancel(id string) (utils.JobStatus, error) {
+	var status utils.JobStatus
+	err := c.do(http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, &status)
+	return status, err
+}
+
+// Worker registrati
+func (c *Client) Workers() ([]utils.WorkerStatus, error) {
+	var workers []utils.WorkerStatus
+	err := c.do(http.MethodGet, "/workers", nil, &workers)
+	return workers, err
+}
+
+// Fallimenti dei task del job successivi all'since-esimo
+func (c *Client) Failures(id string, since int) ([]utils.TaskFailure, error) {
+	var failures []utils.TaskFailure
+	err := c.do(http.MethodGet, "/jobs/"+url.PathEscape(id)+"/failures?since="+strconv.Itoa(since), nil, &failures)
+	return failures, err
+}
+
+// File dell'output del job, con dimensione e SHA-256
+func (c *Client) Output(id string) ([]utils.OutputEntry, error) {
+	var entries []utils.OutputEntry
+	err := c.do(http.MethodGet, "/jobs/"+url.PathEscape(id)+"/output", nil, &entries)
+	return entries, err
+}
+
+// Scarica un file dell'output in dir. Il file viene creato solo se dimensione e SHA-256
+// corrispondono a quelli indicati dal master.
+func (c *Client) Download(id string, entry utils.OutputEntry, dir string) error {
+	dest := localPath(dir, entry.Name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Download senza timeout complessivo: i file di output possono essere grandi
+	req, err := http.NewRequest(http.MethodGet, c.Base+"/jobs/"+url.PathEscape(id)+"/output/"+entry.Name, nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("master non raggiungibile: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkFile(entry, size, hex.EncodeToString(sum.Sum(nil))); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// Percorso locale di un file dell'output
+func localPath(dir, name string) string {
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// Confronta dimensione e SHA-256 di un file con quelli attesi
+func checkFile(entry utils.OutputEntry, size int64, checksum string) error {
+	if size != entry.Size {
+		return fmt.Errorf("%s: %d byte, attesi %d", entry.Name, size, entry.Size)
+	}
+	if checksum != entry.Checksum {
+		return fmt.Errorf("%s: SHA-256 %s, atteso %s", entry.Name, checksum, entry.Checksum)
+	}
+	return nil
+}
+
+// Calcola dimensione e SHA-256 di un file locale
+func fileChecksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	size, err := io.Copy(sum, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(sum.Sum(nil)), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"testing"
+)
+
+// Il download crea il file solo se dimensione e SHA-256 corrispondono al listing del master
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	content := []byte("1\n2\n3\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(content)
+	entry := utils.OutputEntry{Name: "final/part-00000.txt", Size: int64(len(content)), Checksum: hex.EncodeToString(sum[:])}
+	dir := t.TempDir()
+	c := NewClient(srv.URL)
+
+	if err := c.Download("job-1", entry, dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "final", "part-00000.txt"))
+	if err != nil || string(data) != string(content) {
+		t.Fatalf("file scaricato %q, err %v", data, err)
+	}
+
+	entry.Name = "final/part-00001.txt"
+	entry.Checksum = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := c.Download("job-1", entry, dir); err == nil {
+		t.Fatal("checksum errato accettato")
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "final")); len(files) != 1 {
+		t.Fatalf("%d file nella cartella, atteso solo quello verificato", len(files))
+	}
+}
+
+// Il token viene inviato in ogni richiesta, download compresi
+func TestClientSendsToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3greto" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "token dell'API mancante o non valido"}`))
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	if _, err := c.Workers(); err == nil {
+		t.Fatal("richiesta senza token accettata")
+	}
+	c.Token = "s3greto"
+	if _, err := c.Workers(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("[]"))
+	entry := utils.OutputEntry{Name: "final_output.txt", Size: 2, Checksum: hex.EncodeToString(sum[:])}
+	if err := c.Download("job-1", entry, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// -set accetta valori JSON o stringhe e chiavi annidate con il punto
+func TestBuildSettings(t *testing.T) {
+	settings, err := buildSettings("", []string{"count=1000", "jobType=sort", "output.compress=true", "output.format=csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings["count"] != float64(1000) || settings["jobType"] != "sort" {
+		t.Fatalf("impostazioni %v", settings)
+	}
+	output := settings["output"].(map[string]interface{})
+	if output["compress"] != true || output["format"] != "csv" {
+		t.Fatalf("output %v", output)
+	}
+	if _, err := buildSettings("", []string{"count"}); err == nil {
+		t.Fatal("impostazione senza valore accettata")
+	}
+}
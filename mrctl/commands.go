@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sdcc-mapreduce/utils"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ========================================================================================
+// Comandi
+// ========================================================================================
+
+// Impostazioni key=valore passate con -set; il valore è JSON se valido, altrimenti una stringa.
+// Le chiavi con il punto indicano campi annidati (es. output.format=csv).
+type setFlags []string
+
+func (s *setFlags) String() string     { return strings.Join(*s, ",") }
+func (s *setFlags) Set(v string) error { *s = append(*s, v); return nil }
+
+// Costruisce le impostazioni del job dal file (settings o config.json completo) e dai -set
+func buildSettings(file string, sets []string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("%s non valido: %v", file, err)
+		}
+		// config.json completo: si usa solo l'oggetto settings
+		if inner, ok := settings["settings"].(map[string]interface{}); ok {
+			settings = inner
+		}
+	}
+
+	for _, set := range sets {
+		key, raw, ok := strings.Cut(set, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("impostazione %q non valida: usare chiave=valore", set)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+
+		parts := strings.Split(key, ".")
+		node := settings
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = value
+	}
+	return settings, nil
+}
+
+// submit [-f file] [-set chiave=valore ...] [-watch]
+func cmdSubmit(c *Client, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	file := fs.String("f", "", "file JSON con le impostazioni del job (oggetto settings o config.json completo)")
+	var sets setFlags
+	fs.Var(&sets, "set", "impostazione chiave=valore, ripetibile (es. -set count=1000000 -set output.format=csv)")
+	watchJob := fs.Bool("watch", false, "segue il job fino alla conclusione")
+	interval := fs.Duration("interval", time.Second, "intervallo di aggiornamento con -watch")
+	fs.Parse(args)
+
+	settings, err := buildSettings(*file, sets)
+	if err != nil {
+		return err
+	}
+	status, err := c.Submit(settings)
+	if err != nil {
+		return err
+	}
+	if status.State == utils.JobQueued {
+		fmt.Printf("Job %s in coda, posizione %d (job %q, %d valori)\n", status.ID, status.QueuePosition, status.Settings.JobType, status.Settings.Count)
+	} else {
+		fmt.Printf("Job %s avviato (job %q, %d valori)\n", status.ID, status.Settings.JobType, status.Settings.Count)
+	}
+	if !*watchJob {
+		return nil
+	}
+	return watch(c, status.ID, *interval, os.Stdout)
+}
+
+// jobs
+func cmdJobs(c *Client, args []string) error {
+	jobs, err := c.Jobs()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tJOB\tSTATO\tFASE\tCHUNK\tPARTIZIONI\tINVIATO")
+	for _, job := range jobs {
+		phase := job.Phase
+		if job.State == utils.JobQueued {
+			phase = fmt.Sprintf("coda #%d", job.QueuePosition)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%d/%d\t%s\n", job.ID, job.Settings.JobType, job.State, phase,
+			job.ChunksDone, len(job.Chunks), job.PartitionsDone, len(job.Partitions), job.Submitted.Format(time.DateTime))
+	}
+	return tw.Flush()
+}
+
+// status <id>
+func cmdStatus(c *Client, args []string) error {
+	id, err := jobArg("status", args)
+	if err != nil {
+		return err
+	}
+	status, err := c.Job(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Job %s: %s\n", status.ID, progressLine(status))
+	if status.Error != "" {
+		fmt.Printf("Errore: %s\n", status.Error)
+	}
+	if sc := status.Scheduling; sc != nil {
+		fmt.Printf("Scheduler %s: priorità %d, peso %d, quota %.0f%%, slot in uso %d map e %d reduce, %d task in attesa, %d slot assegnati, attesa totale %v\n",
+			sc.Policy, sc.Priority, sc.Weight, sc.Share*100, sc.MapSlots, sc.ReduceSlots, sc.Waiting, sc.Granted, time.Duration(sc.WaitMs)*time.Millisecond)
+		if sc.LastDecision != "" {
+			fmt.Printf("Ultima decisione: %s\n", sc.LastDecision)
+		}
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nCHUNK\tSTATO\tTENTATIVO\tMAPPER")
+	for _, chunk := range status.Chunks {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", chunk.ID, chunk.State, chunk.AttemptID, chunk.Worker)
+	}
+	fmt.Fprintln(tw, "\nPARTIZIONE\tSTATO\tREDUCER")
+	for _, part := range status.Partitions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", part.Owner, part.State, part.Reducer)
+	}
+	return tw.Flush()
+}
+
+// watch <id>
+func cmdWatch(c *Client, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Second, "intervallo di aggiornamento")
+	fs.Parse(args)
+	id, err := jobArg("watch", fs.Args())
+	if err != nil {
+		return err
+	}
+	return watch(c, id, *interval, os.Stdout)
+}
+
+// Segue il job stampando l'avanzamento a ogni cambiamento e i nuovi fallimenti dei task.
+// Restituisce un errore se il job non si conclude con successo.
+func watch(c *Client, id string, interval time.Duration, out io.Writer) error {
+	last := ""
+	since := 0
+	for {
+		status, err := c.Job(id)
+		if err != nil {
+			return err
+		}
+		if line := progressLine(status); line != last {
+			fmt.Fprintf(out, "%s  %s\n", time.Now().Format(time.TimeOnly), line)
+			last = line
+		}
+		if failures, err := c.Failures(id, since); err == nil {
+			for _, f := range failures {
+				printFailure(out, f)
+				since = f.Seq
+			}
+		}
+
+		switch status.State {
+		case utils.JobQueued, utils.JobRunning:
+			time.Sleep(interval)
+		case utils.JobCompleted:
+			return nil
+		default:
+			if status.Error != "" {
+				return fmt.Errorf("job %s %s: %s", id, status.State, status.Error)
+			}
+			return fmt.Errorf("job %s %s", id, status.State)
+		}
+	}
+}
+
+// Riga di avanzamento: stato, fase, chunk e partizioni completati (posizione nella coda per i job in attesa)
+func progressLine(status utils.JobStatus) string {
+	if status.State == utils.JobQueued {
+		return fmt.Sprintf("%s, posizione %d", status.State, status.QueuePosition)
+	}
+	running := 0
+	for _, chunk := range status.Chunks {
+		if chunk.State == utils.TaskRunning || chunk.State == utils.TaskAssigned {
+			running++
+		}
+	}
+	return fmt.Sprintf("%s, fase %s: map %d/%d chunk (%d in esecuzione), reduce %d/%d partizioni",
+		status.State, status.Phase, status.ChunksDone, len(status.Chunks), running, status.PartitionsDone, len(status.Partitions))
+}
+
+// cancel <id>
+func cmdCancel(c *Client, args []string) error {
+	id, err := jobArg("cancel", args)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Cancel(id); err != nil {
+		return err
+	}
+	fmt.Printf("Annullamento del job %s richiesto\n", id)
+	return nil
+}
+
+// workers
+func cmdWorkers(c *Client, args []string) error {
+	workers, err := c.Workers()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDIRIZZO\tRUOLO\tSTATO")
+	for _, w := range workers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", w.Address, w.Role, w.State)
+	}
+	return tw.Flush()
+}
+
+// failures <id> [-follow]
+func cmdFailures(c *Client, args []string) error {
+	fs := flag.NewFlagSet("failures", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "resta in attesa di nuovi fallimenti fino alla conclusione del job")
+	interval := fs.Duration("interval", time.Second, "intervallo di aggiornamento con -follow")
+	fs.Parse(args)
+	id, err := jobArg("failures", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	since := 0
+	for {
+		failures, err := c.Failures(id, since)
+		if err != nil {
+			return err
+		}
+		for _, f := range failures {
+			printFailure(os.Stdout, f)
+			since = f.Seq
+		}
+		if !*follow {
+			return nil
+		}
+		status, err := c.Job(id)
+		if err != nil {
+			return err
+		}
+		if status.State != utils.JobRunning {
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// Stampa un fallimento su una riga
+func printFailure(out io.Writer, f utils.TaskFailure) {
+	task := f.Kind + " " + f.Task
+	if f.AttemptID != "" {
+		task += "/" + f.AttemptID
+	}
+	worker := ""
+	if f.Worker != "" {
+		worker = " su " + f.Worker
+	}
+	fmt.Fprintf(out, "%s  FALLITO %s%s: %s\n", f.Time.Format(time.TimeOnly), task, worker, f.Error)
+}
+
+// fetch <id> [-o dir]
+func cmdFetch(c *Client, args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	dir := fs.String("o", "output", "cartella di destinazione")
+	fs.Parse(args)
+	id, err := jobArg("fetch", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.Output(id)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := c.Download(id, entry, *dir); err != nil {
+			return err
+		}
+		fmt.Printf("OK  %s (%d byte, sha256 %s)\n", localPath(*dir, entry.Name), entry.Size, entry.Checksum)
+	}
+	return verifyManifest(*dir, entries)
+}
+
+// verify <id> [-o dir]: confronta i file già scaricati con l'output del job sul master
+func cmdVerify(c *Client, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dir := fs.String("o", "output", "cartella dei file scaricati")
+	fs.Parse(args)
+	id, err := jobArg("verify", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.Output(id)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, entry := range entries {
+		size, checksum, err := fileChecksum(localPath(*dir, entry.Name))
+		if err == nil {
+			err = checkFile(entry, size, checksum)
+		}
+		if err != nil {
+			fmt.Printf("ERR %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK  %s\n", localPath(*dir, entry.Name))
+	}
+	if err := verifyManifest(*dir, entries); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file su %d non corrispondono all'output del job", failed, len(entries))
+	}
+	return nil
+}
+
+// Con l'output per partizione controlla che i file scaricati corrispondano al manifest
+func verifyManifest(dir string, entries []utils.OutputEntry) error {
+	for _, entry := range entries {
+		if path.Base(entry.Name) != "manifest.json" {
+			continue
+		}
+		data, err := os.ReadFile(localPath(dir, entry.Name))
+		if err != nil {
+			return err
+		}
+		var manifest utils.OutputManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return fmt.Errorf("%s non valido: %v", entry.Name, err)
+		}
+		for _, part := range manifest.Partitions {
+			name := path.Join(path.Dir(entry.Name), part.File)
+			_, checksum, err := fileChecksum(localPath(dir, name))
+			if err != nil {
+				return err
+			}
+			if checksum != part.Checksum {
+				return fmt.Errorf("%s: SHA-256 %s, nel manifest %s", name, checksum, part.Checksum)
+			}
+		}
+		fmt.Printf("Manifest: %d partizioni, %d record, checksum verificati\n", len(manifest.Partitions), manifest.Records)
+	}
+	return nil
+}
+
+// ID del job, unico argomento del comando
+func jobArg(cmd string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("uso: mrctl %s <id>", cmd)
+	}
+	return args[0], nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// mrctl: client a riga di comando dell'API HTTP del master
+func main() {
+	defaultMaster := os.Getenv("MRCTL_MASTER")
+	if defaultMaster == "" {
+		defaultMaster = "http://localhost:8080"
+	}
+	master := flag.String("master", defaultMaster, "indirizzo dell'API del master (anche con MRCTL_MASTER)")
+	token := flag.String("token", os.Getenv("MRCTL_TOKEN"), "token dell'API del master (anche con MRCTL_TOKEN)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	commands := map[string]func(*Client, []string) error{
+		"submit":   cmdSubmit,
+		"jobs":     cmdJobs,
+		"status":   cmdStatus,
+		"watch":    cmdWatch,
+		"cancel":   cmdCancel,
+		"workers":  cmdWorkers,
+		"failures": cmdFailures,
+		"fetch":    cmdFetch,
+		"verify":   cmdVerify,
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "comando sconosciuto: %s\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	client := NewClient(*master)
+	client.Token = *token
+	if err := cmd(client, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "mrctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Uso: mrctl [-master URL] [-token T] <comando> [opzioni]
+
+Comandi:
+  submit [-f file] [-set chiave=valore ...] [-watch]   mette in coda un job
+  jobs                                                 job in coda, in esecuzione e conclusi
+  status <id>                                          stato per chunk e per partizione
+  watch [-interval d] <id>                             segue l'avanzamento fino alla conclusione
+  cancel <id>                                          annulla il job (anche in coda)
+  workers                                              worker registrati e loro stato
+  failures [-follow] <id>                              fallimenti dei task
+  fetch [-o dir] <id>                                  scarica e verifica l'output
+  verify [-o dir] <id>                                 verifica l'output già scaricato
+
+`)
+	flag.PrintDefaults()
+}
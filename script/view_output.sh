@@ -1,6 +1,9 @@
 #!/bin/bash
 
-echo "Contenuto di output/final_output.txt:"
+# Ultimo job eseguito (l'output di ogni job è in output/jobs/<id>/)
+JOB_DIR=${1:-$(ls -td output/jobs/*/ 2>/dev/null | head -1)}
+
+echo "Contenuto di ${JOB_DIR%/}/final_output.txt:"
 echo "----------------------------------------"
-cat output/final_output.txt
+cat "${JOB_DIR%/}/final_output.txt"
 echo
@@ -0,0 +1,131 @@
+package utils
+
+import "time"
+
+// ========================================================================================
+// API HTTP del master: configurazione e messaggi scambiati con i client
+// ========================================================================================
+
+// Configurazione dell'API HTTP del master (valori a zero = default)
+type APIConfig struct {
+	Address   string `json:"address"`             // Indirizzo di ascolto (default :8080)
+	Serve     bool   `json:"serve"`               // Il master non esegue il job di config.json ma attende i job inviati all'API
+	InputRoot string `json:"inputRoot,omitempty"` // Cartella da cui i job inviati all'API leggono input.path (default input)
+	Token     string `json:"token,omitempty"`     // Token richiesto in "Authorization: Bearer" (anche con API_TOKEN)
+	MaxCount  int    `json:"maxCount,omitempty"`  // Valori generati al più da un job inviato all'API (default 10000000)
+}
+
+// Coda dei job del master (valori a zero = default)
+type JobsConfig struct {
+	MaxConcurrent int `json:"maxConcurrent"` // Job eseguiti contemporaneamente sugli stessi worker (default 1)
+	MaxQueued     int `json:"maxQueued"`     // Job in attesa oltre i quali l'invio viene rifiutato (default 100)
+	History       int `json:"history"`       // Job conclusi conservati con il loro output (default 20)
+}
+
+// Scheduler degli slot dei worker tra i job in esecuzione (valori a zero = default)
+type SchedulerConfig struct {
+	Policy      string `json:"policy"`      // fair (default), priority o fifo
+	MapSlots    int    `json:"mapSlots"`    // Task di Map eseguiti contemporaneamente da un mapper (default 1)
+	ReduceSlots int    `json:"reduceSlots"` // Partizioni chiuse contemporaneamente da un reducer (default 1)
+}
+
+// Politiche dello scheduler
+const (
+	FairScheduling     = "fair"     // Slot divisi tra i job in proporzione al peso
+	PriorityScheduling = "priority" // Prima i job a priorità più alta, a parità di priorità in proporzione al peso
+	FIFOScheduling     = "fifo"     // Slot al job inviato per primo
+)
+
+// Stati di un job gestito dal master
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// JobInfo descrive un job inviato al master; viene salvato in state/jobs/<id>/job.json
+// per riprenderlo con le stesse impostazioni dopo un crash
+type JobInfo struct {
+	ID        string    `json:"id"`
+	Settings  Settings  `json:"settings"`
+	Submitted time.Time `json:"submitted"`
+	API       bool      `json:"api,omitempty"` // Inviato all'API: un suo errore non arresta il master
+}
+
+// JobStatus è lo stato di un job restituito da GET /jobs/{id}
+type JobStatus struct {
+	JobInfo
+	State          string              `json:"state"`
+	QueuePosition  int                 `json:"queuePosition,omitempty"` // Posizione nella coda (da 1) per i job in attesa
+	Started        *time.Time          `json:"started,omitempty"`
+	Error          string              `json:"error,omitempty"`
+	Finished       *time.Time          `json:"finished,omitempty"`
+	Phase          string              `json:"phase"` // queued, map, reduce o done
+	ChunksDone     int                 `json:"chunksDone"`
+	PartitionsDone int                 `json:"partitionsDone"`
+	Chunks         []ChunkProgress     `json:"chunks"`
+	Partitions     []PartitionProgress `json:"partitions"`
+	Scheduling     *SchedulingStatus   `json:"scheduling,omitempty"`
+}
+
+// Decisioni dello scheduler per un job
+type SchedulingStatus struct {
+	Policy       string  `json:"policy"`
+	Priority     int     `json:"priority"`
+	Weight       int     `json:"weight"`
+	Share        float64 `json:"share"`       // Quota di slot spettante tra i job in esecuzione (0 con fifo o priorità inferiore)
+	MapSlots     int     `json:"mapSlots"`    // Slot dei mapper in uso
+	ReduceSlots  int     `json:"reduceSlots"` // Slot dei reducer in uso
+	Waiting      int     `json:"waiting"`     // Task in attesa di uno slot
+	Granted      int     `json:"granted"`     // Slot assegnati dall'avvio del job
+	WaitMs       int64   `json:"waitMs"`      // Attesa totale dei task per uno slot
+	LastDecision string  `json:"lastDecision,omitempty"`
+}
+
+// Stato di un chunk nella fase di Map
+type ChunkProgress struct {
+	ID        int    `json:"id"`
+	State     string `json:"state"`
+	AttemptID string `json:"attemptId,omitempty"`
+	Worker    string `json:"worker,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Stato di una partizione nella fase di Reduce
+type PartitionProgress struct {
+	Owner   string `json:"owner"`
+	Reducer string `json:"reducer"` // Reducer che ospita la partizione (diverso da Owner se riassegnata)
+	State   string `json:"state"`
+}
+
+// Stato di un worker registrato, restituito da GET /workers
+type WorkerStatus struct {
+	Address string `json:"address"`
+	Role    string `json:"role"`
+	State   string `json:"state"` // alive, suspect o dead secondo gli heartbeat
+}
+
+// File di output di un job, restituito da GET /jobs/{id}/output
+type OutputEntry struct {
+	Name     string `json:"name"` // Percorso relativo a output/jobs/<id>/, da usare per il download
+	Size     int64  `json:"size"`
+	Checksum string `json:"sha256"` // SHA-256 esadecimale del file
+}
+
+// Fallimento di un task durante il job, restituito da GET /jobs/{id}/failures
+type TaskFailure struct {
+	Seq       int       `json:"seq"` // Progressivo nel job, da 1
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"` // map | reduce
+	Task      string    `json:"task"` // ID del chunk o Owner della partizione
+	AttemptID string    `json:"attemptId,omitempty"`
+	Worker    string    `json:"worker,omitempty"`
+	Error     string    `json:"error"`
+}
+
+// Corpo delle risposte di errore dell'API
+type APIError struct {
+	Error string `json:"error"`
+}
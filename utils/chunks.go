@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+)
+
+// ========================================================================================
+// Contenuto dei chunk: record espliciti o dati generati in streaming
+// ========================================================================================
+
+// GeneratedChunk descrive un chunk di numeri casuali in [Xi, Xf]: chi lo elabora lo rigenera
+// in streaming dal seed, quindi i valori non passano né dalla memoria del master né dalle RPC
+type GeneratedChunk struct {
+	Seed  int64 `json:"seed"`
+	Count int   `json:"count"`
+	Xi    int   `json:"xi"`
+	Xf    int   `json:"xf"`
+}
+
+// Genera i valori del chunk, sempre gli stessi per lo stesso seed
+func (g GeneratedChunk) Each(emit func(Record) error) error {
+	random := rand.New(rand.NewSource(g.Seed))
+	for i := 0; i < g.Count; i++ {
+		if err := emit(Record{Key: strconv.Itoa(random.Intn(g.Xf-g.Xi+1) + g.Xi)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Divide count numeri casuali in chunk da al più size valori, con seed derivati da seed
+func PlanGeneratedChunks(seed int64, count, size, xi, xf int) []ChunkData {
+	var chunks []ChunkData
+	for start, i := 0, 0; start < count; start, i = start+size, i+1 {
+		n := size
+		if start+n > count {
+			n = count - start
+		}
+		chunks = append(chunks, ChunkData{Gen: &GeneratedChunk{Seed: seed + int64(i), Count: n, Xi: xi, Xf: xf}})
+	}
+	return chunks
+}
+
+// ChunkData è il contenuto di un chunk: i record letti dall'input oppure la descrizione
+// di un chunk generato
+type ChunkData struct {
+	Records []Record        `json:"records,omitempty"`
+	Gen     *GeneratedChunk `json:"gen,omitempty"`
+}
+
+// Numero di record del chunk
+func (c ChunkData) Len() int {
+	if c.Gen != nil {
+		return c.Gen.Count
+	}
+	return len(c.Records)
+}
+
+// Scorre i record del chunk, generandoli se necessario
+func (c ChunkData) Each(emit func(Record) error) error {
+	if c.Gen != nil {
+		return c.Gen.Each(emit)
+	}
+	for _, r := range c.Records {
+		if err := emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Accetta anche il formato precedente di chunks.json, in cui ogni chunk era un array di record
+func (c *ChunkData) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, &c.Records)
+	}
+	type plain ChunkData
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// Converte blocchi di record in chunk
+func RecordChunks(parts [][]Record) []ChunkData {
+	chunks := make([]ChunkData, len(parts))
+	for i, p := range parts {
+		chunks[i] = ChunkData{Records: p}
+	}
+	return chunks
+}
+
+// ========================================================================================
+// Reservoir sampling
+// ========================================================================================
+
+// Reservoir mantiene un campione uniforme di al più Size chiavi da un flusso di lunghezza ignota
+type Reservoir struct {
+	Size   int
+	Keys   []string
+	seen   int
+	random *rand.Rand
+}
+
+func NewReservoir(size int, seed int64) *Reservoir {
+	return &Reservoir{Size: size, random: rand.New(rand.NewSource(seed))}
+}
+
+// Aggiunge una chiave del flusso: ogni chiave vista resta nel campione con probabilità Size/visti
+func (r *Reservoir) Add(key string) {
+	r.seen++
+	if len(r.Keys) < r.Size {
+		r.Keys = append(r.Keys, key)
+		return
+	}
+	if j := r.random.Intn(r.seen); j < r.Size {
+		r.Keys[j] = key
+	}
+}
+
+// Numero di chiavi viste
+func (r *Reservoir) Seen() int {
+	return r.seen
+}
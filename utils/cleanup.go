@@ -6,20 +6,29 @@ import (
 	"path/filepath"
 )
 
-// Rimuove tutti i file di output temporanei e finali
-func CleanupOutputFiles() {
-	finalFile := "output/final_output.txt"
-	if err := os.Remove(finalFile); err == nil {
-		log.Printf("File %s rimosso.\n", finalFile)
-	} else if !os.IsNotExist(err) {
-		log.Printf("Errore nella rimozione del file %s: %v\n", finalFile, err)
+// Cartella dell'output di un job: output finale, partizioni scaricate dai reducer e data.txt
+func JobOutputDir(id string) string {
+	return filepath.Join("output", "jobs", id)
+}
+
+// Rimuove l'output di un job (finale e temporaneo)
+func CleanupJobOutput(id string) {
+	dir := JobOutputDir(id)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Errore nella rimozione di %s: %v\n", dir, err)
+		return
 	}
+	log.Printf("Output del job %s rimosso (%s).\n", id, dir)
+}
 
-	tempFiles, err := filepath.Glob("output/temp_*.txt")
+// Rimuove i file temporanei di un job concluso: le partizioni scaricate dai reducer, già unite
+// nell'output finale
+func CleanupJobTempFiles(id string) {
+	tempFiles, err := filepath.Glob(filepath.Join(JobOutputDir(id), "temp_*.txt"))
 	if err != nil {
-		log.Fatalf("Errore nella ricerca dei file temporanei: %v", err)
+		log.Printf("Errore nella ricerca dei file temporanei: %v", err)
+		return
 	}
-
 	for _, tempFile := range tempFiles {
 		if err := os.Remove(tempFile); err == nil {
 			log.Printf("File temporaneo %s rimosso.\n", tempFile)
@@ -27,13 +36,4 @@ func CleanupOutputFiles() {
 			log.Printf("Errore nella rimozione del file temporaneo %s: %v\n", tempFile, err)
 		}
 	}
-
-	dataFile := "output/data.txt"
-	if err := os.Remove(dataFile); err == nil {
-		log.Printf("File %s rimosso.\n", dataFile)
-	} else if !os.IsNotExist(err) {
-		log.Printf("Errore nella rimozione del file %s: %v\n", dataFile, err)
-	}
 }
-
-
@@ -0,0 +1,117 @@
+package utils
+
+import "strconv"
+
+// ========================================================================================
+// Combiner: pre-aggregazione dei record in Map per ridurre il traffico dello shuffle
+// ========================================================================================
+
+// Combiner è implementato dai job che possono combinare in Map i valori di una stessa chiave
+// (es. somme parziali): la Reduce riceve poi sia valori originali sia valori già combinati,
+// quindi Combine deve produrre valori che la Reduce sa unire
+type Combiner interface {
+	Job
+	Combine(key string, values [][]byte) [][]byte
+}
+
+// Numero di occorrenze rappresentate dal record (Count 0 equivale a una)
+func (r Record) Occurrences() int {
+	if r.Count > 1 {
+		return r.Count
+	}
+	return 1
+}
+
+// Aggiunge ai valori di una chiave il valore del record, ripetuto per ogni occorrenza
+func AppendValues(values [][]byte, r Record) [][]byte {
+	for n := r.Occurrences(); n > 0; n-- {
+		values = append(values, r.Value)
+	}
+	return values
+}
+
+// CombineStream combina un flusso di record ordinati per chiave, tenendo in memoria solo il gruppo
+// corrente. Se il job implementa Combiner i valori di ogni chiave passano per Combine; altrimenti
+// i record consecutivi identici diventano un solo record con Count (es. sort: coppie valore, occorrenze).
+// L'ordine delle chiavi non cambia.
+type CombineStream struct {
+	combiner Combiner
+	emit     func(Record) error
+	current  *Record  // Primo record del gruppo corrente
+	values   [][]byte // Con Combiner: valori del gruppo corrente
+	count    int      // Senza Combiner: occorrenze del gruppo corrente
+}
+
+func NewCombineStream(job Job, emit func(Record) error) *CombineStream {
+	combiner, _ := job.(Combiner)
+	return &CombineStream{combiner: combiner, emit: emit}
+}
+
+// Aggiunge il prossimo record del flusso
+func (c *CombineStream) Add(r Record) error {
+	if c.current != nil && !c.sameGroup(r) {
+		if err := c.Flush(); err != nil {
+			return err
+		}
+	}
+	if c.current == nil {
+		c.current = &Record{Key: r.Key, Value: r.Value}
+	}
+	if c.combiner != nil {
+		c.values = AppendValues(c.values, r)
+	} else {
+		c.count += r.Occurrences()
+	}
+	return nil
+}
+
+func (c *CombineStream) sameGroup(r Record) bool {
+	if r.Key != c.current.Key {
+		return false
+	}
+	return c.combiner != nil || string(r.Value) == string(c.current.Value)
+}
+
+// Emette il gruppo corrente; va chiamato anche a fine flusso
+func (c *CombineStream) Flush() error {
+	if c.current == nil {
+		return nil
+	}
+	key := c.current.Key
+	rec := *c.current
+	c.current = nil
+	if c.combiner != nil {
+		values := c.values
+		c.values = nil
+		for _, v := range c.combiner.Combine(key, values) {
+			if err := c.emit(Record{Key: key, Value: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if c.count > 1 {
+		rec.Count = c.count
+	}
+	c.count = 0
+	return c.emit(rec)
+}
+
+// Combina record ordinati per chiave prima dell'invio ai reducer (vedi CombineStream)
+func CombineRecords(job Job, records []Record) []Record {
+	out := make([]Record, 0, len(records))
+	stream := NewCombineStream(job, func(r Record) error {
+		out = append(out, r)
+		return nil
+	})
+	for _, r := range records {
+		stream.Add(r)
+	}
+	stream.Flush()
+	return out
+}
+
+// Somma i contatori di una chiave in un unico valore (combiner di wordcount e histogram)
+func combineCounts(values [][]byte) [][]byte {
+	return [][]byte{[]byte(strconv.Itoa(sumCounts(values)))}
+}
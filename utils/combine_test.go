@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Il combiner non deve cambiare il risultato della Reduce: sort espande le coppie (valore, occorrenze),
+// wordcount somma i conteggi parziali
+func TestCombineRecordsPreservesReduce(t *testing.T) {
+	cases := []struct {
+		job      string
+		records  []Record
+		combined int
+	}{
+		{"sort", IntsToRecords([]int{1, 3, 3, 3, 7, 7, 9}), 4},
+		{"wordcount", []Record{{Key: "a", Value: []byte("1")}, {Key: "a", Value: []byte("2")}, {Key: "b", Value: []byte("1")}}, 2},
+	}
+	for _, c := range cases {
+		job, _ := GetJob(c.job)
+		combined := CombineRecords(job, c.records)
+		if len(combined) != c.combined {
+			t.Errorf("%s: %d record combinati, attesi %d: %v", c.job, len(combined), c.combined, combined)
+		}
+		if got, want := ReduceSorted(job, combined), ReduceSorted(job, c.records); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Reduce dopo il combiner %v, attesa %v", c.job, got, want)
+		}
+	}
+
+	// Una seconda combinazione (es. record già combinati) somma le occorrenze
+	job, _ := GetJob("sort")
+	twice := CombineRecords(job, append(CombineRecords(job, IntsToRecords([]int{4, 4})), Record{Key: "4"}))
+	if len(twice) != 1 || twice[0].Occurrences() != 3 {
+		t.Errorf("combinazione ripetuta: %v, atteso un record con 3 occorrenze", twice)
+	}
+}
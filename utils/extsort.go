@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ========================================================================================
+// Ordinamento esterno: buffer in memoria limitato, spill su disco e merge a più passi
+// ========================================================================================
+
+// Valori di default dell'ordinamento esterno (settings.sortBufferMB e settings.mergeFanIn)
+const (
+	DefaultSortBufferMB = 64
+	DefaultMergeFanIn   = 16
+)
+
+// Stima dell'occupazione in memoria di un record (chiave, valore e struttura)
+func recordSize(r Record) int64 {
+	return int64(len(r.Key) + len(r.Value) + 64)
+}
+
+// ExternalSorter ordina per chiave un flusso di record di dimensione arbitraria: i record restano
+// in un buffer di al più budget byte, che viene ordinato e scritto su disco come run (spill) quando
+// è pieno. Sort unisce poi le run con un merge a più passi di al più fanIn run per passo.
+type ExternalSorter struct {
+	kt     KeyType
+	dir    string
+	budget int64
+	fanIn  int
+	buffer []Record
+	size   int64
+	spills []string
+}
+
+// Crea un ExternalSorter che usa dir per le run (bufferMB e fanIn a zero = default)
+func NewExternalSorter(dir string, kt KeyType, bufferMB, fanIn int) (*ExternalSorter, error) {
+	if bufferMB <= 0 {
+		bufferMB = DefaultSortBufferMB
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ExternalSorter{kt: kt, dir: dir, budget: int64(bufferMB) << 20, fanIn: fanIn}, nil
+}
+
+// Aggiunge un record; se il buffer supera il budget viene scritto su disco
+func (s *ExternalSorter) Add(r Record) error {
+	s.buffer = append(s.buffer, r)
+	s.size += recordSize(r)
+	if s.size >= s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+// Ordina il buffer e lo salva come run
+func (s *ExternalSorter) spill() error {
+	SortRecords(s.buffer, s.kt)
+	path := filepath.Join(s.dir, fmt.Sprintf("spill_%06d.jsonl", len(s.spills)))
+	if err := WriteRunFile(path, s.buffer); err != nil {
+		return err
+	}
+	s.spills = append(s.spills, path)
+	s.buffer = s.buffer[:0]
+	s.size = 0
+	return nil
+}
+
+// Numero di run scritte su disco
+func (s *ExternalSorter) Spills() int {
+	return len(s.spills)
+}
+
+// Chiama emit per ogni record in ordine di chiave (stabile rispetto all'ordine di Add) e restituisce
+// i passi di merge eseguiti: zero se tutti i record sono rimasti in memoria
+func (s *ExternalSorter) Sort(emit func(Record) error) (int, error) {
+	if len(s.spills) == 0 {
+		SortRecords(s.buffer, s.kt)
+		for _, r := range s.buffer {
+			if err := emit(r); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+	if len(s.buffer) > 0 {
+		if err := s.spill(); err != nil {
+			return 0, err
+		}
+	}
+	s.buffer = nil
+	return MergeRunsMultiPass(s.spills, s.kt, s.fanIn, s.dir, emit)
+}
+
+// Rimuove le run dal disco
+func (s *ExternalSorter) Close() error {
+	s.buffer = nil
+	return os.RemoveAll(s.dir)
+}
+
+// Unisce le run con merge successivi di al più fanIn run (0 = default), salvando i risultati
+// intermedi in tmpDir, e chiama emit per ogni record del merge finale. Restituisce il numero di passi.
+// Le run intermedie vengono rimosse appena unite; quelle indicate in paths restano.
+func MergeRunsMultiPass(paths []string, kt KeyType, fanIn int, tmpDir string, emit func(Record) error) (int, error) {
+	if fanIn < 2 {
+		fanIn = DefaultMergeFanIn
+	}
+	intermediate := make(map[string]bool)
+	defer func() {
+		for path := range intermediate {
+			os.Remove(path)
+		}
+	}()
+
+	passes := 0
+	for len(paths) > fanIn {
+		passes++
+		var next []string
+		for i := 0; i < len(paths); i += fanIn {
+			group := paths[i:min(i+fanIn, len(paths))]
+			if len(group) == 1 {
+				next = append(next, group[0])
+				continue
+			}
+			out := filepath.Join(tmpDir, fmt.Sprintf("merge_p%02d_%06d.jsonl", passes, i/fanIn))
+			err := writeFileAtomic(out, func(w io.Writer) error {
+				encoder := json.NewEncoder(w)
+				return MergeRuns(group, kt, func(r Record) error {
+					return encoder.Encode(r)
+				})
+			})
+			if err != nil {
+				return passes, err
+			}
+			for _, path := range group {
+				if intermediate[path] {
+					os.Remove(path)
+					delete(intermediate, path)
+				}
+			}
+			intermediate[out] = true
+			next = append(next, out)
+		}
+		paths = next
+	}
+	return passes + 1, MergeRuns(paths, kt, emit)
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Con un buffer minimo l'ordinamento scrive più run su disco e le unisce in più passi:
+// il risultato è ordinato, completo e le run temporanee vengono rimosse
+func TestExternalSorterSpillsAndMergesInPasses(t *testing.T) {
+	kt, _ := GetKeyType("int")
+	dir := filepath.Join(t.TempDir(), "sort")
+	sorter, err := NewExternalSorter(dir, kt, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorter.budget = 64 * 1024 // ~800 record per run
+
+	chunk := GeneratedChunk{Seed: 7, Count: 10000, Xi: -500, Xf: 500}
+	if err := chunk.Each(sorter.Add); err != nil {
+		t.Fatal(err)
+	}
+	if sorter.Spills() < 8 {
+		t.Fatalf("%d run su disco, attese almeno 8", sorter.Spills())
+	}
+
+	var prev *Record
+	n := 0
+	passes, err := sorter.Sort(func(r Record) error {
+		if prev != nil && kt.Compare(prev.Key, r.Key) > 0 {
+			t.Fatalf("record non ordinati: %s dopo %s", r.Key, prev.Key)
+		}
+		prev = &r
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != chunk.Count {
+		t.Errorf("%d record ordinati, attesi %d", n, chunk.Count)
+	}
+	if passes < 3 {
+		t.Errorf("%d passi di merge con fan-in 2, attesi almeno 3", passes)
+	}
+
+	if err := sorter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cartella delle run non rimossa: %v", err)
+	}
+}
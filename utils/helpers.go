@@ -12,23 +12,123 @@ import (
 
 // MapRequest e MapReply per la fase di Map
 type MapRequest struct {
-	Chunk         []int             // Dati del chunk da ordinare
-	ReducerRanges map[string][2]int // Mappa dei range assegnati a ciascun reducer
+	JobID         string            // Job a cui appartiene il task (namespace dei file sui worker)
+	Chunk         ChunkData         // Record del chunk (o descrizione del chunk generato)
+	Partition     PartitionSpec     // Assegnazione delle chiavi ai reducer
+	KeyType       string            // Tipo delle chiavi (vuoto = int)
+	JobType       string            // Nome del job registrato da eseguire (vuoto = sort)
+	ChunkID       int               // Identificativo del chunk
+	AttemptID     string            // Identificativo del tentativo (più tentativi per chunk con l'esecuzione speculativa)
+	Only          []string          // Se non vuoto, consegna solo le partizioni di questi Owner (ricostruzione di una partizione)
+	Combine       bool              // Combina i record di ogni partizione prima dell'invio
+	Shuffle       string            // Modalità di shuffle: push (vuoto) o pull
+	SortBufferMB  int               // Memoria per l'ordinamento esterno (0 = default del worker)
+	MergeFanIn    int               // Run unite al più in un passo di merge (0 = default del worker)
 }
 
 type MapReply struct {
-	Ack bool // Conferma dell'esecuzione da parte del mapper
+	Ack         bool           // Conferma dell'esecuzione da parte del mapper
+	Sent        map[string]int // Record destinati a ciascun Owner
+	Undelivered []string       // Owner il cui reducer non ha accettato la consegna
+	Segments    map[string]ShuffleSegment // Shuffle pull: segmenti conservati dal mapper per Owner
+}
+
+// Chunk è un blocco di record identificato dalla sua posizione in chunks.json
+type Chunk struct {
+	ID   int
+	Data ChunkData
+}
+
+// Associa a ogni chunk il proprio indice come identificativo
+func IndexChunks(chunks []ChunkData) []Chunk {
+	indexed := make([]Chunk, len(chunks))
+	for i, c := range chunks {
+		indexed[i] = Chunk{ID: i, Data: c}
+	}
+	return indexed
 }
 
 // ReduceRequest e ReduceReply per la fase di Reduce
 type ReduceRequest struct {
-   Chunks        []int  `json:"chunks"`
-   WorkerAddress string `json:"workerAddress"` 
-   Owner         string `json:"owner"`         
+   JobID         string   `json:"jobId"`         // Job a cui appartiene la consegna
+   Segment       ShuffleSegment `json:"segment"` // Dove il reducer legge i record (solo metadati)
+   WorkerAddress string   `json:"workerAddress"` 
+   Owner         string   `json:"owner"`         
+   JobType       string   `json:"jobType"`
+   KeyType       string   `json:"keyType"`
+   ChunkID       int      `json:"chunkId"`   // Chunk da cui provengono i record
+   AttemptID     string   `json:"attemptId"` // Tentativo di Map che li ha prodotti
 }
 
 type ReduceReply struct {
-	Ack bool
+	Ack       bool
+	Duplicate bool // La consegna era già stata applicata ed è stata ignorata
+}
+
+// FinalizeRequest e FinalizeReply per chiudere la partizione di un reducer a fine fase di Map
+type FinalizeRequest struct {
+	JobID    string         // Job della partizione
+	Owner    string         // Owner della partizione
+	JobType  string         // Job di cui applicare la Reduce
+	KeyType  string         // Tipo delle chiavi, per l'ordine del merge
+	Accepted map[int]string // Tentativo accettato per ogni chunk: le run degli altri tentativi vengono scartate
+	MergeFanIn int          // Run unite al più in un passo di merge (0 = default del worker)
+}
+
+type FinalizeReply struct {
+	Ack           bool
+	Runs          int // Numero di run unite
+	MergePasses   int // Passi di merge eseguiti
+	InputRecords  int // Record letti dalle run
+	InputValues   int // Valori passati alla Reduce (record espansi secondo Count)
+	OutputRecords int // Record scritti nel file della partizione
+}
+
+// FetchRequest e FetchReply per scaricare dal reducer il file di una partizione chiusa, un blocco alla volta
+type FetchRequest struct {
+	JobID  string // Job della partizione
+	Owner  string // Owner della partizione
+	Offset int64  // Posizione da cui leggere
+}
+
+type FetchReply struct {
+	Data []byte // Contenuto a partire da Offset
+	EOF  bool   // Data arriva fino alla fine del file
+}
+
+// ReleaseJobRequest chiede a un worker di eliminare i file di un job concluso (run, partizioni, shuffle)
+type ReleaseJobRequest struct {
+	JobID string
+}
+
+type ReleaseJobReply struct {
+	Removed int // File e cartelle rimossi
+}
+
+// HeartbeatRequest e HeartbeatReply per il segnale di vita periodico dei worker
+type HeartbeatRequest struct {
+	Address string // Indirizzo del worker
+	Role    string // mapper/reducer
+}
+
+type HeartbeatReply struct {
+	Registered bool // false se il master non conosce il worker, che deve registrarsi di nuovo
+	IntervalMs int  // Intervallo richiesto tra due heartbeat
+}
+
+// Configurazione degli heartbeat (valori a zero = default del master)
+type HeartbeatConfig struct {
+	IntervalMs     int `json:"intervalMs"`     // Ogni quanto i worker inviano un heartbeat
+	SuspectAfterMs int `json:"suspectAfterMs"` // Senza heartbeat da questo tempo il worker è "suspect"
+	DeadAfterMs    int `json:"deadAfterMs"`    // Senza heartbeat da questo tempo il worker è "dead"
+}
+
+// Configurazione dell'esecuzione speculativa (valori a zero = default del master)
+type SpeculationConfig struct {
+	Enabled      bool    `json:"enabled"`      // Abilita i tentativi di backup
+	Threshold    float64 `json:"threshold"`    // Frazione di chunk completati oltre cui speculare (default 0.75)
+	SlowFactor   float64 `json:"slowFactor"`   // Lento se dura più di slowFactor × mediana (default 2)
+	MinRuntimeMs int     `json:"minRuntimeMs"` // Durata minima prima di un backup (default 2000)
 }
 
 // Configurazione dei worker
@@ -44,6 +144,23 @@ type Settings struct {
 	Xi          int `json:"xi"`          // Valore minimo
 	Xf          int `json:"xf"`          // Valore massimo
 	Count       int `json:"count"`       // Numero di valori casuali generati
+	JobType     string `json:"jobType"` // Tipo di job da eseguire (sort, wordcount, histogram, ...)
+	KeyType     string `json:"keyType,omitempty"` // Tipo delle chiavi: int (default), int64, float, string
+	Partitioner string `json:"partitioner,omitempty"` // Partizionamento: sampled (default), uniform, hash o registrato
+	Skew        bool   `json:"skew,omitempty"` // Con sampled: divide le chiavi calde tra più reducer
+	Combiner    bool   `json:"combiner,omitempty"` // Combina in Map i record di ogni partizione prima dello shuffle
+	Shuffle     string `json:"shuffle,omitempty"` // push (default): i mapper consegnano ai reducer; pull: i reducer scaricano dai mapper
+	SortBufferMB int   `json:"sortBufferMB,omitempty"` // Memoria dei worker per ordinare un chunk prima dello spill su disco (default 64)
+	MergeFanIn  int    `json:"mergeFanIn,omitempty"` // Run unite al più in un passo di merge, in Map e in Reduce (default 16)
+	Input       *InputConfig `json:"input,omitempty"` // Sorgente dei dati (assente = generazione casuale)
+	Output      *OutputConfig `json:"output,omitempty"` // Formato del risultato (assente = testo in final_output.txt)
+	Heartbeat   *HeartbeatConfig `json:"heartbeat,omitempty"` // Timeout di liveness dei worker
+	Speculation *SpeculationConfig `json:"speculation,omitempty"` // Tentativi di backup per i chunk lenti
+	API         *APIConfig `json:"api,omitempty"` // API HTTP del master (invio dei job, stato, output)
+	Jobs        *JobsConfig `json:"jobs,omitempty"` // Coda dei job del master (concorrenza, storico)
+	Scheduler   *SchedulerConfig `json:"scheduler,omitempty"` // Divisione degli slot dei worker tra i job
+	Priority    int    `json:"priority,omitempty"` // Priorità del job (più alta = prima; default 0)
+	Weight      int    `json:"weight,omitempty"` // Peso del job nella divisione degli slot (default 1)
 }
 
 type Config struct {
@@ -67,17 +184,15 @@ func LoadConfig(path string) Config {
 	return config
 }
 
-// Funzione per inviare i numeri ordinati al reducer appropriato
-func SendToReducer(num []int, address string) error {
+// Funzione per inviare i record ordinati al reducer appropriato
+func SendToReducer(req ReduceRequest, address string) error {
 	client, err := rpc.Dial("tcp", address)
 	if err != nil {
 		return fmt.Errorf("errore di connessione al reducer %s: %v", address, err)
 	}
 	defer client.Close()
 
-	req := ReduceRequest{
-		Chunks: num,
-	}
+	req.WorkerAddress = address
 	reply := ReduceReply{}
 	err = client.Call("Worker.ReduceTask", req, &reply)
 	if err != nil {
@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ========================================================================================
+// Sorgenti di input
+// ========================================================================================
+
+// InputConfig descrive da dove leggere il dataset invece di generarlo
+type InputConfig struct {
+	Path        string `json:"path"`                  // File singolo o glob (es. input/*.csv)
+	Format      string `json:"format"`                // text, csv, json, jsonl, binary (vuoto = dedotto dall'estensione)
+	Column      int    `json:"column"`                // Colonna CSV della chiave (0-based)
+	ValueColumn *int   `json:"valueColumn,omitempty"` // Colonna CSV del valore (assente = solo chiave)
+	Header      bool   `json:"header"`                // Il CSV ha una riga di intestazione da saltare
+}
+
+// InputSource produce i record del dataset
+type InputSource interface {
+	Read() ([]Record, error)
+}
+
+// Verifica formato e colonne; il percorso viene controllato all'apertura della sorgente
+func (c InputConfig) Validate() error {
+	if _, ok := inputParsers[c.Format]; c.Format != "" && !ok {
+		return fmt.Errorf("formato di input sconosciuto: %q", c.Format)
+	}
+	if c.Column < 0 {
+		return fmt.Errorf("input.column negativa: %d", c.Column)
+	}
+	if c.ValueColumn != nil && *c.ValueColumn < 0 {
+		return fmt.Errorf("input.valueColumn negativa: %d", *c.ValueColumn)
+	}
+	return nil
+}
+
+// Verifica che input.path (anche glob) resti sotto la cartella root: relativo e senza uscire con ..
+func (c InputConfig) CheckRoot(root string) error {
+	path := filepath.Clean(c.Path)
+	if filepath.IsAbs(path) {
+		return fmt.Errorf("input.path %q: ammessi solo percorsi relativi sotto %s/", c.Path, root)
+	}
+	rel, err := filepath.Rel(filepath.Clean(root), path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("input.path %q: ammessi solo file sotto %s/", c.Path, root)
+	}
+	return nil
+}
+
+// Crea la sorgente descritta dalla configurazione, espandendo il glob in uno o più file.
+// Le chiavi lette vengono validate e normalizzate secondo il tipo kt.
+func NewInputSource(cfg InputConfig, kt KeyType) (InputSource, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("input.path mancante")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("glob %q non valido: %v", cfg.Path, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nessun file corrisponde a %q", cfg.Path)
+	}
+	sort.Strings(paths)
+
+	var sources multiSource
+	for _, path := range paths {
+		format := cfg.Format
+		if format == "" {
+			format = formatFromExtension(path)
+		}
+		parse, ok := inputParsers[format]
+		if !ok {
+			return nil, fmt.Errorf("formato di input sconosciuto %q per %s", format, path)
+		}
+		sources = append(sources, fileSource{path: path, cfg: cfg, kt: kt, parse: parse})
+	}
+	return sources, nil
+}
+
+// Deduce il formato dall'estensione del file (text se non riconosciuta)
+func formatFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	case ".jsonl":
+		return "jsonl"
+	case ".bin", ".i64":
+		return "binary"
+	}
+	return "text"
+}
+
+// Parser di un formato: legge tutti i record dallo stream
+type inputParser func(r *bufio.Reader, cfg InputConfig, kt KeyType) ([]Record, error)
+
+// fileSource legge un singolo file con il parser del suo formato
+type fileSource struct {
+	path  string
+	cfg   InputConfig
+	kt    KeyType
+	parse inputParser
+}
+
+func (f fileSource) Read() ([]Record, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := f.parse(bufio.NewReader(file), f.cfg, f.kt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", f.path, err)
+	}
+	return data, nil
+}
+
+// multiSource concatena i dati di più file, nell'ordine dato
+type multiSource []InputSource
+
+func (m multiSource) Read() ([]Record, error) {
+	var data []Record
+	for _, src := range m {
+		part, err := src.Read()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, part...)
+	}
+	return data, nil
+}
+
+// ========================================================================================
+// Parser dei formati supportati
+// ========================================================================================
+
+var inputParsers = map[string]inputParser{
+	"text":   parseTextRecords,
+	"csv":    parseCSVRecords,
+	"json":   parseJSONRecords,
+	"jsonl":  parseJSONRecords,
+	"binary": parseBinaryRecords,
+}
+
+// Un record per riga: "chiave" oppure "chiave<TAB>valore"; righe vuote ignorate
+func parseTextRecords(r *bufio.Reader, _ InputConfig, kt KeyType) ([]Record, error) {
+	var data []Record
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		rec := ParseRecord(text)
+		key, err := kt.Parse(rec.Key)
+		if err != nil {
+			return nil, fmt.Errorf("riga %d: %v", line, err)
+		}
+		rec.Key = key
+		data = append(data, rec)
+	}
+	return data, scanner.Err()
+}
+
+// Legge la chiave dalla colonna cfg.Column (e il valore da cfg.ValueColumn) di un CSV,
+// saltando l'intestazione se richiesto
+func parseCSVRecords(r *bufio.Reader, cfg InputConfig, kt KeyType) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var data []Record
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && cfg.Header {
+			continue
+		}
+		if cfg.Column >= len(row) {
+			return nil, fmt.Errorf("riga %d: colonna %d assente", line, cfg.Column)
+		}
+		key, err := kt.Parse(row[cfg.Column])
+		if err != nil {
+			return nil, fmt.Errorf("riga %d: %v", line, err)
+		}
+		rec := Record{Key: key}
+		if cfg.ValueColumn != nil {
+			if *cfg.ValueColumn >= len(row) {
+				return nil, fmt.Errorf("riga %d: colonna %d assente", line, *cfg.ValueColumn)
+			}
+			rec.Value = []byte(row[*cfg.ValueColumn])
+		}
+		data = append(data, rec)
+	}
+	return data, nil
+}
+
+// Uno o più valori JSON concatenati nel file: array di elementi oppure elementi singoli, es. uno
+// per riga (jsonl, come l'output in quel formato). Ogni elemento è una chiave (numero o stringa)
+// oppure un oggetto {"key": ..., "value": "..."}
+func parseJSONRecords(r *bufio.Reader, _ InputConfig, kt KeyType) ([]Record, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var data []Record
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		arr := []json.RawMessage{raw}
+		if raw[0] == '[' {
+			if err := json.Unmarshal(raw, &arr); err != nil {
+				return nil, err
+			}
+		}
+		for _, elem := range arr {
+			rec, err := parseJSONElement(elem, kt)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, rec)
+		}
+	}
+	return data, nil
+}
+
+func parseJSONElement(raw json.RawMessage, kt KeyType) (Record, error) {
+	var obj struct {
+		Key   json.RawMessage `json:"key"`
+		Value *string         `json:"value"`
+	}
+	keyRaw := raw
+	if len(raw) > 0 && raw[0] == '{' {
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return Record{}, err
+		}
+		if obj.Key == nil {
+			return Record{}, fmt.Errorf("elemento %s senza chiave", raw)
+		}
+		keyRaw = obj.Key
+	}
+
+	// La chiave può essere un numero (testo letterale) o una stringa JSON
+	text := string(keyRaw)
+	if len(keyRaw) > 0 && keyRaw[0] == '"' {
+		if err := json.Unmarshal(keyRaw, &text); err != nil {
+			return Record{}, err
+		}
+	}
+	key, err := kt.Parse(text)
+	if err != nil {
+		return Record{}, err
+	}
+
+	rec := Record{Key: key}
+	if obj.Value != nil {
+		rec.Value = []byte(*obj.Value)
+	}
+	return rec, nil
+}
+
+// Sequenza di chiavi nella codifica binaria del tipo (int64 little-endian per gli interi)
+func parseBinaryRecords(r *bufio.Reader, _ InputConfig, kt KeyType) ([]Record, error) {
+	var data []Record
+	for {
+		key, err := kt.ReadBinary(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, Record{Key: key})
+	}
+	return data, nil
+}
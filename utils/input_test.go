@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Legge il testo con il parser del formato
+func parseInput(t *testing.T, format, text string, cfg InputConfig, keyType string) ([]Record, error) {
+	t.Helper()
+	kt, err := GetKeyType(keyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inputParsers[format](bufio.NewReader(strings.NewReader(text)), cfg, kt)
+}
+
+func TestInputParsersReadValues(t *testing.T) {
+	valueColumn := 2
+
+	cases := []struct {
+		format string
+		cfg    InputConfig
+		text   string
+	}{
+		{"text", InputConfig{}, "b\tdue\n\na\tuno\n"},
+		{"csv", InputConfig{Column: 1, ValueColumn: &valueColumn, Header: true}, "id,nome,valore\n1,b,due\n2,a,uno\n"},
+		{"json", InputConfig{}, `[{"key": "b", "value": "due"}, {"key": "a", "value": "uno"}]`},
+		{"jsonl", InputConfig{}, "{\"key\": \"b\", \"value\": \"due\"}\n{\"key\": \"a\", \"value\": \"uno\"}\n"},
+	}
+	want := []Record{{Key: "b", Value: []byte("due")}, {Key: "a", Value: []byte("uno")}}
+	for _, c := range cases {
+		got, err := parseInput(t, c.format, c.text, c.cfg, "string")
+		if err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: letto %v, atteso %v", c.format, got, want)
+		}
+	}
+}
+
+// Chiavi numeriche e stringa, singole o in array, anche mescolate nello stesso file
+func TestJSONInputKeys(t *testing.T) {
+	got, err := parseInput(t, "jsonl", "3\n[1, \"2\"]\n{\"key\": 007}\n", InputConfig{}, "int")
+	if err == nil {
+		t.Fatalf("JSON non valido accettato: %v", got)
+	}
+	got, err = parseInput(t, "jsonl", "3\n[1, \"2\"]\n{\"key\": -4}\n", InputConfig{}, "int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{{Key: "3"}, {Key: "1"}, {Key: "2"}, {Key: "-4"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("letto %v, atteso %v", got, want)
+	}
+	if _, err := parseInput(t, "json", `[{"value": "x"}]`, InputConfig{}, "int"); err == nil {
+		t.Error("elemento senza chiave accettato")
+	}
+}
+
+// Con chiavi intere una chiave non numerica è un errore, non un record scartato
+func TestInputInvalidKeys(t *testing.T) {
+	if _, err := parseInput(t, "text", "1\nx\n", InputConfig{}, "int"); err == nil {
+		t.Error("text: chiave non intera accettata")
+	}
+	if _, err := parseInput(t, "csv", "1,a\nx,b\n", InputConfig{}, "int"); err == nil {
+		t.Error("csv: chiave non intera accettata")
+	}
+	if _, err := parseInput(t, "jsonl", "{\"key\": \"x\"}\n", InputConfig{}, "int"); err == nil {
+		t.Error("jsonl: chiave non intera accettata")
+	}
+}
+
+func TestCSVInputColumns(t *testing.T) {
+	valueColumn := 3
+	if _, err := parseInput(t, "csv", "1,a\n2\n", InputConfig{Column: 1}, "string"); err == nil {
+		t.Error("colonna della chiave assente non segnalata")
+	}
+	if _, err := parseInput(t, "csv", "1,a\n", InputConfig{ValueColumn: &valueColumn}, "string"); err == nil {
+		t.Error("colonna del valore assente non segnalata")
+	}
+
+	// Le colonne negative vengono rifiutate prima di leggere i file
+	negative := -1
+	for _, cfg := range []InputConfig{{Path: "x.csv", Column: -1}, {Path: "x.csv", ValueColumn: &negative}} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("colonna negativa accettata: %+v", cfg)
+		}
+		if _, err := NewInputSource(cfg, intKey{}); err == nil {
+			t.Errorf("sorgente creata con colonna negativa: %+v", cfg)
+		}
+	}
+	if err := (InputConfig{Format: "xml"}).Validate(); err == nil {
+		t.Error("formato sconosciuto accettato")
+	}
+}
+
+// I job inviati all'API non leggono fuori dalla cartella di input
+func TestInputCheckRoot(t *testing.T) {
+	for _, path := range []string{"input/data.csv", "input/*.csv", "./input/sub/../a.txt", "input/sub/*/x.json"} {
+		if err := (InputConfig{Path: path}).CheckRoot("input"); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/etc/passwd", "input/../config/config.json", "../input/x", "input", "state/*.json", "inputs/x"} {
+		if err := (InputConfig{Path: path}).CheckRoot("input"); err == nil {
+			t.Errorf("%s accettato fuori da input/", path)
+		}
+	}
+}
+
+// Il glob viene espanso in ordine e il formato dedotto dall'estensione di ogni file
+func TestInputSourceGlob(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "3\n1\n", "b.csv": "2,x\n", "c.jsonl": "5\n"}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source, err := NewInputSource(InputConfig{Path: filepath.Join(dir, "*")}, intKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := source.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Key)
+	}
+	if want := []string{"3", "1", "2", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("letto %v, atteso %v", got, want)
+	}
+
+	if _, err := NewInputSource(InputConfig{Path: filepath.Join(dir, "*.bin")}, intKey{}); err == nil {
+		t.Error("glob senza file accettato")
+	}
+}
+
+// Un float binario troncato viene segnalato, non letto come fine del file
+func TestBinaryInputTruncated(t *testing.T) {
+	kt, _ := GetKeyType("float")
+	path := filepath.Join(t.TempDir(), "trunc.bin")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{1}, 12), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source, _ := NewInputSource(InputConfig{Path: path}, kt)
+	if _, err := source.Read(); err == nil {
+		t.Error("record troncato non segnalato")
+	}
+}
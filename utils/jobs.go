@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ========================================================================================
+// Record e interfaccia dei job
+// ========================================================================================
+
+// Record è la coppia chiave/valore che attraversa le fasi di Map e Reduce
+type Record struct {
+	Key   string `json:"key"`             // Chiave usata per ordinamento e partizionamento
+	Value []byte `json:"value,omitempty"` // Valore opzionale associato alla chiave
+	Count int    `json:"count,omitempty"` // Occorrenze del record unite dal combiner (0 = una)
+}
+
+// Job è l'interfaccia che il codice utente implementa per definire un tipo di job
+type Job interface {
+	// Map trasforma i record di un chunk in record intermedi; può essere chiamata più volte
+	// su porzioni consecutive dello stesso chunk (ordinamento esterno dei chunk grandi)
+	Map(records []Record) []Record
+	// Reduce riceve tutti i valori di una chiave e produce i record di output
+	Reduce(key string, values [][]byte) []Record
+}
+
+// SplittableJob è implementato dai job la cui Reduce tratta ogni valore in modo indipendente
+// (es. sort): solo per questi il partizionamento skew può dividere una chiave tra più reducer
+type SplittableJob interface {
+	Job
+	SplitKeys() bool
+}
+
+// Indica se le occorrenze di una stessa chiave possono finire in partizioni diverse
+func CanSplitKeys(job Job) bool {
+	s, ok := job.(SplittableJob)
+	return ok && s.SplitKeys()
+}
+
+// DefaultJobType è il job usato quando la configurazione non ne specifica uno
+const DefaultJobType = "sort"
+
+var (
+	jobsMu   sync.RWMutex
+	registry = make(map[string]Job)
+)
+
+// RegisterJob registra un'implementazione di Job con il nome indicato
+func RegisterJob(name string, job Job) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("job %q già registrato", name))
+	}
+	registry[name] = job
+}
+
+// GetJob restituisce il job registrato con il nome indicato ("" equivale a DefaultJobType)
+func GetJob(name string) (Job, error) {
+	if name == "" {
+		name = DefaultJobType
+	}
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	job, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("tipo di job sconosciuto: %q", name)
+	}
+	return job, nil
+}
+
+// JobTypes restituisce i nomi dei job registrati, in ordine alfabetico
+func JobTypes() []string {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterJob("sort", sortJob{})
+	RegisterJob("wordcount", wordCountJob{})
+	RegisterJob("histogram", histogramJob{Width: 10})
+}
+
+// ========================================================================================
+// Utility sui record
+// ========================================================================================
+
+// Converte una slice di interi in record con chiave numerica e senza valore
+func IntsToRecords(nums []int) []Record {
+	records := make([]Record, len(nums))
+	for i, n := range nums {
+		records[i] = Record{Key: strconv.Itoa(n)}
+	}
+	return records
+}
+
+// Confronta due chiavi in un ordine totale: prima le chiavi intere, in ordine numerico,
+// poi le altre (es. parole del wordcount), in ordine lessicografico
+func CompareKeys(a, b string) int {
+	ai, errA := strconv.Atoi(a)
+	bi, errB := strconv.Atoi(b)
+	return compareParsed(a, b, ai, bi, errA == nil, errB == nil)
+}
+
+// Ordina i record per chiave, secondo il tipo di chiave, mantenendo l'ordine relativo delle chiavi uguali
+func SortRecords(records []Record, kt KeyType) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return kt.Compare(records[i].Key, records[j].Key) < 0
+	})
+}
+
+// Raggruppa record già ordinati per chiave e applica la Reduce del job a ogni gruppo
+func ReduceSorted(job Job, records []Record) []Record {
+	var out []Record
+	for i := 0; i < len(records); {
+		j := i
+		var values [][]byte
+		for j < len(records) && records[j].Key == records[i].Key {
+			values = AppendValues(values, records[j])
+			j++
+		}
+		out = append(out, job.Reduce(records[i].Key, values)...)
+		i = j
+	}
+	return out
+}
+
+// Formatta un record come riga di testo: solo la chiave se il valore è vuoto, altrimenti "chiave\tvalore"
+func FormatRecord(r Record) string {
+	if len(r.Value) == 0 {
+		return r.Key
+	}
+	return r.Key + "\t" + string(r.Value)
+}
+
+// ========================================================================================
+// Job predefiniti
+// ========================================================================================
+
+// sortJob ordina le chiavi: la Map è l'identità e la Reduce riemette ogni occorrenza
+type sortJob struct{}
+
+func (sortJob) Map(records []Record) []Record {
+	return records
+}
+
+func (sortJob) Reduce(key string, values [][]byte) []Record {
+	out := make([]Record, len(values))
+	for i, v := range values {
+		out[i] = Record{Key: key, Value: v}
+	}
+	return out
+}
+
+// La Reduce riemette ogni occorrenza: una chiave calda può essere divisa tra più reducer
+func (sortJob) SplitKeys() bool {
+	return true
+}
+
+// wordCountJob conta le occorrenze di ogni parola presente nei record
+type wordCountJob struct{}
+
+func (wordCountJob) Map(records []Record) []Record {
+	var out []Record
+	for _, r := range records {
+		text := r.Key
+		if len(r.Value) > 0 {
+			text = string(r.Value)
+		}
+		for _, word := range strings.Fields(text) {
+			out = append(out, Record{Key: word, Value: []byte("1")})
+		}
+	}
+	return out
+}
+
+func (wordCountJob) Reduce(key string, values [][]byte) []Record {
+	return []Record{{Key: key, Value: []byte(strconv.Itoa(sumCounts(values)))}}
+}
+
+func (wordCountJob) Combine(key string, values [][]byte) [][]byte {
+	return combineCounts(values)
+}
+
+// histogramJob conta quanti valori cadono in ogni intervallo di ampiezza Width
+type histogramJob struct {
+	Width int
+}
+
+func (h histogramJob) Map(records []Record) []Record {
+	out := make([]Record, 0, len(records))
+	for _, r := range records {
+		n, err := strconv.Atoi(r.Key)
+		if err != nil {
+			continue
+		}
+		// Arrotonda verso -inf anche per valori negativi
+		bucket := n / h.Width * h.Width
+		if n < 0 && n%h.Width != 0 {
+			bucket -= h.Width
+		}
+		out = append(out, Record{Key: strconv.Itoa(bucket), Value: []byte("1")})
+	}
+	return out
+}
+
+func (histogramJob) Reduce(key string, values [][]byte) []Record {
+	return []Record{{Key: key, Value: []byte(strconv.Itoa(sumCounts(values)))}}
+}
+
+func (histogramJob) Combine(key string, values [][]byte) [][]byte {
+	return combineCounts(values)
+}
+
+// Somma i contatori testuali ignorando quelli non numerici
+func sumCounts(values [][]byte) int {
+	total := 0
+	for _, v := range values {
+		n, err := strconv.Atoi(string(v))
+		if err == nil {
+			total += n
+		}
+	}
+	return total
+}
@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ========================================================================================
+// Tipi di chiave: confronto e codifica
+// ========================================================================================
+
+// KeyType definisce come interpretare le chiavi dei record: confronto per l'ordinamento,
+// forma canonica testuale e codifica binaria per input/output "binary".
+// Le chiavi viaggiano sempre come stringhe in forma canonica.
+type KeyType interface {
+	// Parse valida una chiave testuale e ne restituisce la forma canonica
+	Parse(text string) (string, error)
+	// Compare restituisce <0, 0, >0 se a precede, equivale o segue b
+	Compare(a, b string) int
+	// AppendBinary aggiunge a dst la codifica binaria della chiave
+	AppendBinary(dst []byte, key string) ([]byte, error)
+	// ReadBinary legge una chiave codificata con AppendBinary (io.EOF a fine stream)
+	ReadBinary(r io.Reader) (string, error)
+}
+
+// DefaultKeyType è il tipo usato quando la configurazione non ne specifica uno
+const DefaultKeyType = "int"
+
+var (
+	keyTypesMu sync.RWMutex
+	keyTypes   = make(map[string]KeyType)
+)
+
+// RegisterKeyType registra un tipo di chiave con il nome indicato
+func RegisterKeyType(name string, kt KeyType) {
+	keyTypesMu.Lock()
+	defer keyTypesMu.Unlock()
+	if _, exists := keyTypes[name]; exists {
+		panic(fmt.Sprintf("tipo di chiave %q già registrato", name))
+	}
+	keyTypes[name] = kt
+}
+
+// GetKeyType restituisce il tipo di chiave registrato con il nome indicato ("" equivale a DefaultKeyType)
+func GetKeyType(name string) (KeyType, error) {
+	if name == "" {
+		name = DefaultKeyType
+	}
+	keyTypesMu.RLock()
+	defer keyTypesMu.RUnlock()
+	kt, ok := keyTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("tipo di chiave sconosciuto: %q", name)
+	}
+	return kt, nil
+}
+
+// KeyTypeNames restituisce i nomi dei tipi di chiave registrati, in ordine alfabetico
+func KeyTypeNames() []string {
+	keyTypesMu.RLock()
+	defer keyTypesMu.RUnlock()
+	names := make([]string, 0, len(keyTypes))
+	for name := range keyTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Indica se le chiavi del tipo sono interi (partizionabili per range numerico)
+func IsIntegerKeyType(kt KeyType) bool {
+	switch kt.(type) {
+	case intKey, int64Key:
+		return true
+	}
+	return false
+}
+
+// Indica se le chiavi del tipo sono numeri (interi o float), confrontati numericamente
+func IsNumericKeyType(kt KeyType) bool {
+	if _, ok := kt.(floatKey); ok {
+		return true
+	}
+	return IsIntegerKeyType(kt)
+}
+
+func init() {
+	RegisterKeyType("int", intKey{})
+	RegisterKeyType("int64", int64Key{})
+	RegisterKeyType("float", floatKey{})
+	RegisterKeyType("string", stringKey{})
+}
+
+// ========================================================================================
+// Tipi predefiniti
+// ========================================================================================
+
+// Ordine totale dei tipi numerici: prima le chiavi interpretabili (okA/okB), confrontate per
+// valore, poi le altre in ordine lessicografico. Un confronto misto numerico/lessicografico
+// non sarebbe transitivo ("9" < "10" < "5x" < "9") e romperebbe ordinamento, merge e partizionamento.
+func compareParsed[T cmp.Ordered](a, b string, x, y T, okA, okB bool) int {
+	switch {
+	case okA && okB:
+		return cmp.Compare(x, y)
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// intKey: interi, con le chiavi non numeriche prodotte da alcuni job (es. parole del wordcount)
+// dopo tutti gli interi, in ordine lessicografico. È il tipo storico dell'ordinamento di interi.
+type intKey struct{}
+
+func (intKey) Parse(text string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return "", fmt.Errorf("%q non è un intero", text)
+	}
+	return strconv.Itoa(n), nil
+}
+
+func (intKey) Compare(a, b string) int {
+	return CompareKeys(a, b)
+}
+
+func (intKey) AppendBinary(dst []byte, key string) ([]byte, error) {
+	return appendInt64(dst, key)
+}
+
+func (intKey) ReadBinary(r io.Reader) (string, error) {
+	return readInt64(r)
+}
+
+// int64Key: interi a 64 bit (es. ID), confrontati numericamente
+type int64Key struct{}
+
+func (int64Key) Parse(text string) (string, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q non è un int64", text)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func (int64Key) Compare(a, b string) int {
+	ai, errA := strconv.ParseInt(a, 10, 64)
+	bi, errB := strconv.ParseInt(b, 10, 64)
+	return compareParsed(a, b, ai, bi, errA == nil, errB == nil)
+}
+
+func (int64Key) AppendBinary(dst []byte, key string) ([]byte, error) {
+	return appendInt64(dst, key)
+}
+
+func (int64Key) ReadBinary(r io.Reader) (string, error) {
+	return readInt64(r)
+}
+
+// floatKey: numeri in virgola mobile (es. misure), confrontati numericamente
+type floatKey struct{}
+
+func (floatKey) Parse(text string) (string, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || math.IsNaN(f) {
+		return "", fmt.Errorf("%q non è un numero", text)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+func (floatKey) Compare(a, b string) int {
+	af, errA := strconv.ParseFloat(a, 64)
+	bf, errB := strconv.ParseFloat(b, 64)
+	return compareParsed(a, b, af, bf, errA == nil, errB == nil)
+}
+
+func (floatKey) AppendBinary(dst []byte, key string) ([]byte, error) {
+	f, err := strconv.ParseFloat(key, 64)
+	if err != nil {
+		return dst, fmt.Errorf("chiave %q non rappresentabile come float64", key)
+	}
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(f)), nil
+}
+
+func (floatKey) ReadBinary(r io.Reader) (string, error) {
+	var buf [8]byte
+	if err := readFull(r, buf[:]); err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), 'g', -1, 64), nil
+}
+
+// stringKey: stringhe arbitrarie, confrontate byte per byte
+type stringKey struct{}
+
+func (stringKey) Parse(text string) (string, error) {
+	return text, nil
+}
+
+func (stringKey) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+// Lunghezza come uvarint seguita dai byte della chiave
+func (stringKey) AppendBinary(dst []byte, key string) ([]byte, error) {
+	dst = binary.AppendUvarint(dst, uint64(len(key)))
+	return append(dst, key...), nil
+}
+
+func (stringKey) ReadBinary(r io.Reader) (string, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		return "", errors.New("lettura di chiavi stringa binarie: serve un io.ByteReader")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", errors.New("lunghezza della chiave troncata")
+		}
+		return "", err
+	}
+	buf := make([]byte, n)
+	if err := readFull(r, buf); err != nil {
+		if err == io.EOF {
+			return "", errors.New("chiave troncata")
+		}
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// ========================================================================================
+// Codifica binaria degli interi
+// ========================================================================================
+
+func appendInt64(dst []byte, key string) ([]byte, error) {
+	n, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return dst, fmt.Errorf("chiave %q non rappresentabile come int64", key)
+	}
+	return binary.LittleEndian.AppendUint64(dst, uint64(n)), nil
+}
+
+func readInt64(r io.Reader) (string, error) {
+	var buf [8]byte
+	if err := readFull(r, buf[:]); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(int64(binary.LittleEndian.Uint64(buf[:])), 10), nil
+}
+
+// Come io.ReadFull, ma distingue la fine pulita dello stream (io.EOF) da un record troncato
+func readFull(r io.Reader, buf []byte) error {
+	_, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("record binario troncato (attesi %d byte)", len(buf))
+	}
+	return err
+}
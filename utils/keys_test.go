@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyTypesSortOrder(t *testing.T) {
+	cases := []struct {
+		keyType string
+		input   []string
+		want    []string
+	}{
+		{"int", []string{"10", "-3", "2"}, []string{"-3", "2", "10"}},
+		{"int64", []string{"9007199254740993", "-1", "42"}, []string{"-1", "42", "9007199254740993"}},
+		{"float", []string{"2.5", "-0.75", "1e3", "10"}, []string{"-0.75", "2.5", "10", "1000"}},
+		{"string", []string{"pera", "Mela", "banana"}, []string{"Mela", "banana", "pera"}},
+	}
+	for _, c := range cases {
+		kt, err := GetKeyType(c.keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []Record
+		for _, text := range c.input {
+			key, err := kt.Parse(text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q): %v", c.keyType, text, err)
+			}
+			records = append(records, Record{Key: key})
+		}
+		SortRecords(records, kt)
+
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Key)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: ordine %v, atteso %v", c.keyType, got, c.want)
+		}
+	}
+
+	// Chiavi miste (es. output del wordcount con keyType int): ordine totale, interi prima
+	mixed := []Record{{Key: "5x"}, {Key: "10"}, {Key: "9"}, {Key: "abc"}, {Key: "-1"}}
+	SortRecords(mixed, intKey{})
+	var got []string
+	for _, r := range mixed {
+		got = append(got, r.Key)
+	}
+	if want := []string{"-1", "9", "10", "5x", "abc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chiavi miste: ordine %v, atteso %v", got, want)
+	}
+	for _, kt := range []KeyType{intKey{}, int64Key{}, floatKey{}} {
+		if kt.Compare("9", "10") >= 0 || kt.Compare("10", "5x") >= 0 || kt.Compare("9", "5x") >= 0 {
+			t.Errorf("%T: ordine non transitivo su 9, 10, 5x", kt)
+		}
+	}
+
+	if _, err := GetKeyType("uuid"); err == nil {
+		t.Error("tipo di chiave sconosciuto accettato")
+	}
+}
+
+// Le chiavi scritte in output binary si rileggono identiche come input binary
+func TestKeyTypesBinaryRoundTrip(t *testing.T) {
+	for name, keys := range map[string][]string{
+		"int":    {"-7", "0", "123456"},
+		"float":  {"-0.5", "3.25", "1e+100"},
+		"string": {"", "ciao", "con\ttab"},
+	} {
+		kt, _ := GetKeyType(name)
+		path := filepath.Join(t.TempDir(), "keys.bin")
+
+		out, err := CreateOutputFile(path, OutputConfig{Format: "binary"}, kt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			if err := out.Write(Record{Key: k}); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		source, err := NewInputSource(InputConfig{Path: path}, kt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := source.Read()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Key)
+		}
+		if !reflect.DeepEqual(got, keys) {
+			t.Errorf("%s: riletto %q, atteso %q", name, got, keys)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ========================================================================================
+// Sink di output
+// ========================================================================================
+
+// OutputConfig descrive formato e organizzazione del risultato finale
+type OutputConfig struct {
+	Format       string `json:"format"`       // text (default), csv, jsonl, binary
+	Compress     bool   `json:"compress"`     // Comprime i file con gzip
+	PerPartition bool   `json:"perPartition"` // Un file per partizione + manifest invece di un file unico
+}
+
+// RecordWriter scrive record in un formato di output
+type RecordWriter interface {
+	Write(r Record) error
+	Close() error
+}
+
+// Estensione dei file di output per il formato indicato (con .gz se compressi)
+func (c OutputConfig) Extension() string {
+	ext := ".txt"
+	switch c.Format {
+	case "csv":
+		ext = ".csv"
+	case "jsonl":
+		ext = ".jsonl"
+	case "binary":
+		ext = ".bin"
+	}
+	if c.Compress {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// Verifica che il formato richiesto sia supportato
+func (c OutputConfig) Validate() error {
+	switch c.Format {
+	case "", "text", "csv", "jsonl", "binary":
+		return nil
+	}
+	return fmt.Errorf("formato di output sconosciuto: %q", c.Format)
+}
+
+// OutputFile è un file di output aperto, con conteggio dei record e checksum del contenuto scritto
+type OutputFile struct {
+	Path    string
+	Records int
+
+	file   *os.File
+	buf    *bufio.Writer
+	gz     *gzip.Writer
+	sum    hash.Hash
+	writer RecordWriter
+}
+
+// Crea un file di output nel formato richiesto, eventualmente compresso.
+// kt determina la codifica delle chiavi nel formato binary.
+func CreateOutputFile(path string, cfg OutputConfig, kt KeyType) (*OutputFile, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &OutputFile{Path: path, file: file, sum: sha256.New()}
+	out.buf = bufio.NewWriter(io.MultiWriter(file, out.sum))
+
+	var w io.Writer = out.buf
+	if cfg.Compress {
+		out.gz = gzip.NewWriter(out.buf)
+		w = out.gz
+	}
+	out.writer = newRecordWriter(w, cfg.Format, kt)
+	return out, nil
+}
+
+// Write scrive un record nel file
+func (o *OutputFile) Write(r Record) error {
+	if err := o.writer.Write(r); err != nil {
+		return err
+	}
+	o.Records++
+	return nil
+}
+
+// Close svuota i buffer e chiude il file
+func (o *OutputFile) Close() error {
+	err := o.writer.Close()
+	if o.gz != nil {
+		if gzErr := o.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if flushErr := o.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Checksum SHA-256 del file scritto (valido dopo Close)
+func (o *OutputFile) Checksum() string {
+	return hex.EncodeToString(o.sum.Sum(nil))
+}
+
+// Crea il writer per il formato indicato (text se vuoto)
+func newRecordWriter(w io.Writer, format string, kt KeyType) RecordWriter {
+	switch format {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}
+	case "jsonl":
+		return &jsonlWriter{enc: json.NewEncoder(w)}
+	case "binary":
+		return &binaryWriter{w: w, kt: kt}
+	}
+	return &textWriter{w: w}
+}
+
+// textWriter: una riga per record, come FormatRecord
+type textWriter struct{ w io.Writer }
+
+func (t *textWriter) Write(r Record) error {
+	_, err := io.WriteString(t.w, FormatRecord(r)+"\n")
+	return err
+}
+func (t *textWriter) Close() error { return nil }
+
+// csvWriter: chiave ed eventuale valore come colonne CSV
+type csvWriter struct{ w *csv.Writer }
+
+func (c *csvWriter) Write(r Record) error {
+	row := []string{r.Key}
+	if len(r.Value) > 0 {
+		row = append(row, string(r.Value))
+	}
+	return c.w.Write(row)
+}
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter: un oggetto JSON per riga
+type jsonlWriter struct{ enc *json.Encoder }
+
+func (j *jsonlWriter) Write(r Record) error {
+	return j.enc.Encode(struct {
+		Key   string `json:"key"`
+		Value string `json:"value,omitempty"`
+	}{r.Key, string(r.Value)})
+}
+func (j *jsonlWriter) Close() error { return nil }
+
+// binaryWriter: chiavi nella codifica binaria del loro tipo (i valori non sono rappresentabili)
+type binaryWriter struct {
+	w   io.Writer
+	kt  KeyType
+	buf []byte
+}
+
+func (b *binaryWriter) Write(r Record) error {
+	var err error
+	b.buf, err = b.kt.AppendBinary(b.buf[:0], r.Key)
+	if err != nil {
+		return err
+	}
+	_, err = b.w.Write(b.buf)
+	return err
+}
+func (b *binaryWriter) Close() error { return nil }
+
+// Legge una riga scritta con FormatRecord ("chiave" oppure "chiave\tvalore")
+func ParseRecord(line string) Record {
+	key, value, found := strings.Cut(line, "\t")
+	if !found {
+		return Record{Key: key}
+	}
+	return Record{Key: key, Value: []byte(value)}
+}
+
+// ========================================================================================
+// Manifest delle partizioni
+// ========================================================================================
+
+// PartitionManifest descrive un file di partizione scritto in modalità perPartition
+type PartitionManifest struct {
+	File     string `json:"file"`
+	Reducer  string `json:"reducer"`
+	Lower    string `json:"lower,omitempty"` // Prima chiave della partizione (solo range; assente = illimitato)
+	Upper    string `json:"upper,omitempty"` // Chiave di taglio esclusa (solo range; assente = illimitato)
+	Records  int    `json:"records"`
+	Checksum string `json:"sha256"`
+}
+
+// OutputManifest elenca i file di output nell'ordine in cui vanno concatenati
+type OutputManifest struct {
+	Format     string              `json:"format"`
+	Compressed bool                `json:"compressed"`
+	Records    int                 `json:"records"`
+	Partitions []PartitionManifest `json:"partitions"`
+}
+
+// Scrive il manifest in formato JSON leggibile
+func WriteManifest(path string, manifest OutputManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Rilegge un file di output nel formato indicato, decomprimendolo se necessario
+func readOutput(t *testing.T, path string, cfg OutputConfig, kt KeyType) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if cfg.Compress {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var records []Record
+	switch cfg.Format {
+	case "", "text":
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			records = append(records, ParseRecord(scanner.Text()))
+		}
+	case "csv":
+		// I record senza valore hanno una sola colonna
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		rows, err := reader.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			rec := Record{Key: row[0]}
+			if len(row) > 1 {
+				rec.Value = []byte(row[1])
+			}
+			records = append(records, rec)
+		}
+	case "jsonl":
+		records, err = parseJSONRecords(bufio.NewReader(r), InputConfig{}, kt)
+	case "binary":
+		records, err = parseBinaryRecords(bufio.NewReader(r), InputConfig{}, kt)
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return records
+}
+
+// Ogni formato, compresso o no, si rilegge con gli stessi record; il checksum è quello del file scritto
+func TestOutputFormatsRoundTrip(t *testing.T) {
+	kt, _ := GetKeyType("string")
+	withValues := []Record{{Key: "a", Value: []byte("uno, con virgola")}, {Key: "b"}, {Key: "c\"d", Value: []byte("tre")}}
+	keysOnly := []Record{{Key: "a"}, {Key: "b"}, {Key: "c\"d"}}
+
+	for _, format := range []string{"text", "csv", "jsonl", "binary"} {
+		for _, compress := range []bool{false, true} {
+			cfg := OutputConfig{Format: format, Compress: compress}
+			path := filepath.Join(t.TempDir(), "final_output"+cfg.Extension())
+			out, err := CreateOutputFile(path, cfg, kt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range withValues {
+				if err := out.Write(r); err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+			}
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if out.Records != len(withValues) {
+				t.Errorf("%s: %d record contati, attesi %d", path, out.Records, len(withValues))
+			}
+
+			// Il formato binary rappresenta solo le chiavi
+			want := withValues
+			if format == "binary" {
+				want = keysOnly
+			}
+			if got := readOutput(t, path, cfg, kt); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: riletto %q, atteso %q", path, got, want)
+			}
+
+			data, _ := os.ReadFile(path)
+			sum := sha256.Sum256(data)
+			if out.Checksum() != hex.EncodeToString(sum[:]) {
+				t.Errorf("%s: checksum %s diverso da quello del file", path, out.Checksum())
+			}
+		}
+	}
+}
+
+func TestOutputConfig(t *testing.T) {
+	if ext := (OutputConfig{Format: "jsonl", Compress: true}).Extension(); ext != ".jsonl.gz" {
+		t.Errorf("estensione %q", ext)
+	}
+	if err := (OutputConfig{Format: "xml"}).Validate(); err == nil {
+		t.Error("formato sconosciuto accettato")
+	}
+	if _, err := CreateOutputFile(filepath.Join(t.TempDir(), "x"), OutputConfig{Format: "xml"}, intKey{}); err == nil {
+		t.Error("file creato con formato sconosciuto")
+	}
+
+	// Una chiave non intera non è rappresentabile in binary con chiavi int
+	out, err := CreateOutputFile(filepath.Join(t.TempDir(), "x.bin"), OutputConfig{Format: "binary"}, intKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := out.Write(Record{Key: "x"}); err == nil {
+		t.Error("chiave non intera scritta in binary")
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	manifest := OutputManifest{
+		Format:  "csv",
+		Records: 3,
+		Partitions: []PartitionManifest{
+			{File: "part-00000.csv", Reducer: "r1:9001", Upper: "10", Records: 2, Checksum: strings.Repeat("a", 64)},
+			{File: "part-00001.csv", Reducer: "r2:9001", Lower: "10", Records: 1, Checksum: strings.Repeat("b", 64)},
+		},
+	}
+	if err := WriteManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got OutputManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, manifest) {
+		t.Errorf("manifest riletto %+v, atteso %+v", got, manifest)
+	}
+	if !strings.Contains(string(data), `"sha256"`) {
+		t.Errorf("checksum assente dal manifest: %s", data)
+	}
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// ========================================================================================
+// Partizionamento delle chiavi tra i reducer
+// ========================================================================================
+
+// PartitionSpec descrive come le chiavi vengono distribuite tra i reducer.
+// Il master la calcola una volta per job, la salva nello stato e la invia ai mapper.
+type PartitionSpec struct {
+	Strategy string   `json:"strategy"`         // Partitioner registrato: range, hash o personalizzato
+	Reducers []string `json:"reducers"`         // Owner della partizione i-esima (il reducer iniziale), in ordine di partizione
+	Bounds   []string `json:"bounds,omitempty"` // Solo range: len(Reducers)-1 chiavi di taglio crescenti
+	Skew     bool     `json:"skew,omitempty"`   // Solo range: confini ripetuti per le chiavi calde
+
+	// Partizioni riassegnate dopo la perdita del loro reducer: Owner → reducer attuale
+	Assigned map[string]string `json:"assigned,omitempty"`
+}
+
+// Partitioner assegna una chiave a una partizione
+type Partitioner interface {
+	// Partition restituisce l'indice della partizione (0..len(Reducers)-1) della chiave
+	Partition(key string) int
+}
+
+// SpreadPartitioner è un Partitioner che può dividere una chiave calda tra più partizioni contigue
+type SpreadPartitioner interface {
+	Partitioner
+	// Span restituisce la prima partizione della chiave e quante partizioni consecutive la condividono
+	Span(key string) (first, n int)
+}
+
+// PartitionerFactory costruisce un Partitioner dalla descrizione inviata dal master
+type PartitionerFactory func(spec PartitionSpec, kt KeyType) (Partitioner, error)
+
+const (
+	RangePartitioner = "range" // Confini calcolati dal master (sampling o intervallo uniforme)
+	HashPartitioner  = "hash"  // Hash della chiave modulo il numero di reducer
+)
+
+var (
+	partitionersMu sync.RWMutex
+	partitioners   = make(map[string]PartitionerFactory)
+)
+
+// RegisterPartitioner registra un partitioner con il nome indicato, da usare come settings.partitioner
+func RegisterPartitioner(name string, factory PartitionerFactory) {
+	partitionersMu.Lock()
+	defer partitionersMu.Unlock()
+	if _, exists := partitioners[name]; exists {
+		panic(fmt.Sprintf("partitioner %q già registrato", name))
+	}
+	partitioners[name] = factory
+}
+
+// Indica se esiste un partitioner registrato con il nome indicato
+func PartitionerRegistered(name string) bool {
+	partitionersMu.RLock()
+	defer partitionersMu.RUnlock()
+	_, ok := partitioners[name]
+	return ok
+}
+
+// PartitionerNames restituisce i nomi dei partitioner registrati, in ordine alfabetico
+func PartitionerNames() []string {
+	partitionersMu.RLock()
+	defer partitionersMu.RUnlock()
+	names := make([]string, 0, len(partitioners))
+	for name := range partitioners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPartitioner costruisce il partitioner descritto da spec
+func NewPartitioner(spec PartitionSpec, kt KeyType) (Partitioner, error) {
+	if len(spec.Reducers) == 0 {
+		return nil, fmt.Errorf("partizionamento %q senza reducer", spec.Strategy)
+	}
+	partitionersMu.RLock()
+	factory, ok := partitioners[spec.Strategy]
+	partitionersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("partitioner sconosciuto: %q", spec.Strategy)
+	}
+	return factory(spec, kt)
+}
+
+// Indirizzo del reducer che ospita ora la partizione dell'Owner
+func (s PartitionSpec) Target(owner string) string {
+	if addr, ok := s.Assigned[owner]; ok {
+		return addr
+	}
+	return owner
+}
+
+// Copia indipendente (la mappa delle riassegnazioni non è condivisa)
+func (s PartitionSpec) Clone() PartitionSpec {
+	if s.Assigned != nil {
+		assigned := make(map[string]string, len(s.Assigned))
+		for owner, addr := range s.Assigned {
+			assigned[owner] = addr
+		}
+		s.Assigned = assigned
+	}
+	return s
+}
+
+// Estremi [lower, upper) della partizione i per il partizionamento a range ("" = illimitato).
+// Con skew una partizione con lower == upper contiene solo la sua quota della chiave calda.
+func (s PartitionSpec) Range(i int) (lower, upper string) {
+	if s.Strategy != RangePartitioner {
+		return "", ""
+	}
+	if i > 0 {
+		lower = s.Bounds[i-1]
+	}
+	if i < len(s.Bounds) {
+		upper = s.Bounds[i]
+	}
+	return lower, upper
+}
+
+func init() {
+	RegisterPartitioner(RangePartitioner, newRangePartitioner)
+	RegisterPartitioner(HashPartitioner, newHashPartitioner)
+}
+
+// ========================================================================================
+// Partitioner predefiniti
+// ========================================================================================
+
+// rangePartitioner: la chiave va nella partizione i se Bounds[i-1] <= chiave < Bounds[i].
+// La ricerca è binaria sui confini; le chiavi non valide per il tipo (es. parole prodotte
+// da un job con chiavi intere) ripiegano sull'hash.
+// Con skew una chiave ripetuta c volte tra i confini è calda e occupa le c partizioni
+// che iniziano con lei: l'output concatenato resta ordinato.
+type rangePartitioner struct {
+	bounds []string
+	kt     KeyType
+	hash   hashPartitioner
+}
+
+func newRangePartitioner(spec PartitionSpec, kt KeyType) (Partitioner, error) {
+	if len(spec.Bounds) != len(spec.Reducers)-1 {
+		return nil, fmt.Errorf("partizionamento a range: %d confini per %d reducer", len(spec.Bounds), len(spec.Reducers))
+	}
+	for i := 1; i < len(spec.Bounds); i++ {
+		cmp := kt.Compare(spec.Bounds[i-1], spec.Bounds[i])
+		if cmp > 0 || (cmp == 0 && !spec.Skew) {
+			return nil, fmt.Errorf("partizionamento a range: confini non crescenti %v", spec.Bounds)
+		}
+	}
+	return rangePartitioner{bounds: spec.Bounds, kt: kt, hash: hashPartitioner(len(spec.Reducers))}, nil
+}
+
+func (r rangePartitioner) Partition(key string) int {
+	first, _ := r.Span(key)
+	return first
+}
+
+func (r rangePartitioner) Span(key string) (int, int) {
+	if _, err := r.kt.Parse(key); err != nil {
+		return r.hash.Partition(key), 1
+	}
+	// lo: confini minori della chiave; hi: confini minori o uguali
+	lo := sort.Search(len(r.bounds), func(i int) bool {
+		return r.kt.Compare(key, r.bounds[i]) <= 0
+	})
+	hi := sort.Search(len(r.bounds), func(i int) bool {
+		return r.kt.Compare(key, r.bounds[i]) < 0
+	})
+	if hi-lo < 2 {
+		return hi, 1
+	}
+	return lo + 1, hi - lo
+}
+
+// hashPartitioner: FNV-1a della chiave modulo il numero di partizioni
+type hashPartitioner int
+
+func newHashPartitioner(spec PartitionSpec, _ KeyType) (Partitioner, error) {
+	return hashPartitioner(len(spec.Reducers)), nil
+}
+
+func (h hashPartitioner) Partition(key string) int {
+	f := fnv.New32a()
+	f.Write([]byte(key))
+	return int(f.Sum32() % uint32(h))
+}
+
+// ========================================================================================
+// Assegnazione dei record
+// ========================================================================================
+
+// Assigner assegna le chiavi di un flusso di record alle partizioni. Le occorrenze di una chiave
+// calda vengono distribuite a turno sulle partizioni che la condividono, partendo da seed
+// (es. l'ID del chunk): lo stesso input produce sempre la stessa assegnazione, anche tra tentativi diversi.
+type Assigner struct {
+	p      Partitioner
+	spread SpreadPartitioner
+	seed   int
+	seen   map[string]int
+}
+
+func NewAssigner(p Partitioner, seed int) *Assigner {
+	spread, _ := p.(SpreadPartitioner)
+	return &Assigner{p: p, spread: spread, seed: seed, seen: make(map[string]int)}
+}
+
+// Partizione del prossimo record con chiave key
+func (a *Assigner) Assign(key string) int {
+	if a.spread == nil {
+		return a.p.Partition(key)
+	}
+	first, n := a.spread.Span(key)
+	if n <= 1 {
+		return first
+	}
+	part := first + (a.seed+a.seen[key])%n
+	a.seen[key]++
+	return part
+}
+
+// Assegna ogni record a una partizione (vedi Assigner)
+func AssignPartitions(p Partitioner, records []Record, seed int) []int {
+	parts := make([]int, len(records))
+	assigner := NewAssigner(p, seed)
+	for i, r := range records {
+		parts[i] = assigner.Assign(r.Key)
+	}
+	return parts
+}
@@ -0,0 +1,89 @@
+package utils
+
+import "testing"
+
+func TestRangePartitionerTypedBounds(t *testing.T) {
+	cases := []struct {
+		keyType string
+		bounds  []string
+		keys    map[string]int
+	}{
+		{"int", []string{"10", "20"}, map[string]int{"-5": 0, "9": 0, "10": 1, "19": 1, "20": 2, "1000": 2}},
+		{"float", []string{"0.5", "2"}, map[string]int{"-1": 0, "0.5": 1, "1.99": 1, "2": 2}},
+		{"string", []string{"g", "p"}, map[string]int{"banana": 0, "g": 1, "mela": 1, "pera": 2, "uva": 2}},
+	}
+	for _, c := range cases {
+		kt, _ := GetKeyType(c.keyType)
+		spec := PartitionSpec{Strategy: RangePartitioner, Reducers: []string{"r0", "r1", "r2"}, Bounds: c.bounds}
+		p, err := NewPartitioner(spec, kt)
+		if err != nil {
+			t.Fatalf("%s: %v", c.keyType, err)
+		}
+		for key, want := range c.keys {
+			if got := p.Partition(key); got != want {
+				t.Errorf("%s: chiave %q nella partizione %d, attesa %d", c.keyType, key, got, want)
+			}
+		}
+	}
+}
+
+func TestPartitionerFallbackAndValidation(t *testing.T) {
+	kt, _ := GetKeyType("int")
+	spec := PartitionSpec{Strategy: RangePartitioner, Reducers: []string{"r0", "r1"}, Bounds: []string{"10"}}
+	p, err := NewPartitioner(spec, kt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Le chiavi non intere (es. parole del wordcount) vanno per hash, in modo deterministico
+	hash, _ := NewPartitioner(PartitionSpec{Strategy: HashPartitioner, Reducers: spec.Reducers}, kt)
+	if got, want := p.Partition("ciao"), hash.Partition("ciao"); got != want {
+		t.Errorf("chiave non intera nella partizione %d, attesa %d (hash)", got, want)
+	}
+
+	invalid := []PartitionSpec{
+		{Strategy: RangePartitioner, Reducers: []string{"r0", "r1"}},
+		{Strategy: RangePartitioner, Reducers: []string{"r0", "r1", "r2"}, Bounds: []string{"5", "5"}},
+		{Strategy: HashPartitioner},
+		{Strategy: "sconosciuto", Reducers: []string{"r0"}},
+	}
+	for _, s := range invalid {
+		if _, err := NewPartitioner(s, kt); err == nil {
+			t.Errorf("partizionamento non valido accettato: %+v", s)
+		}
+	}
+}
+
+// Una chiave calda ripetuta tra i confini viene divisa a turno tra le sue partizioni,
+// mantenendo l'ordine delle partizioni rispetto alle altre chiavi
+func TestAssignPartitionsSpreadsHotKey(t *testing.T) {
+	kt, _ := GetKeyType("int")
+	spec := PartitionSpec{Strategy: RangePartitioner, Reducers: []string{"r0", "r1", "r2", "r3"}, Bounds: []string{"10", "10", "20"}, Skew: true}
+	p, err := NewPartitioner(spec, kt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := IntsToRecords([]int{5, 10, 10, 10, 10, 15, 25})
+	got := AssignPartitions(p, records, 0)
+	want := []int{0, 1, 2, 1, 2, 2, 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("assegnazione %v, attesa %v", got, want)
+		}
+	}
+
+	// Stesso input e stesso seed: stessa assegnazione (tentativi ripetuti dello stesso chunk)
+	again := AssignPartitions(p, records, 0)
+	for i := range got {
+		if got[i] != again[i] {
+			t.Fatalf("assegnazione non deterministica: %v e %v", got, again)
+		}
+	}
+
+	// Senza skew i confini ripetuti non sono ammessi
+	spec.Skew = false
+	if _, err := NewPartitioner(spec, kt); err == nil {
+		t.Error("confini ripetuti accettati senza skew")
+	}
+}
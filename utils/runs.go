@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ========================================================================================
+// Run: sequenze di record ordinati salvate su file (un record JSON per riga)
+// ========================================================================================
+
+// Scrive una run su file in modo atomico (file temporaneo univoco + rename),
+// così più scrittori della stessa run non si sovrappongono
+func WriteRunFile(path string, records []Record) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, r := range records {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunReader legge in streaming i record di una run
+type RunReader struct {
+	file    *os.File
+	decoder *json.Decoder
+}
+
+// Apre una run in lettura
+func OpenRun(path string) (*RunReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RunReader{file: file, decoder: json.NewDecoder(bufio.NewReader(file))}, nil
+}
+
+// Next restituisce il prossimo record; ok è false a fine run
+func (r *RunReader) Next() (rec Record, ok bool, err error) {
+	err = r.decoder.Decode(&rec)
+	if err == io.EOF {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("run %s corrotta: %v", r.file.Name(), err)
+	}
+	return rec, true, nil
+}
+
+// Close chiude il file della run
+func (r *RunReader) Close() error {
+	return r.file.Close()
+}
+
+// ========================================================================================
+// Merge k-way
+// ========================================================================================
+
+// Elemento dell'heap: record corrente di una run
+type mergeItem struct {
+	rec Record
+	run int
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	kt    KeyType
+}
+
+func (h mergeHeap) Len() int { return len(h.items) }
+func (h mergeHeap) Less(i, j int) bool {
+	if c := h.kt.Compare(h.items[i].rec.Key, h.items[j].rec.Key); c != 0 {
+		return c < 0
+	}
+	// A parità di chiave preserva l'ordine delle run per un merge stabile
+	return h.items[i].run < h.items[j].run
+}
+func (h mergeHeap) Swap(i, j int)       { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x interface{}) { h.items = append(h.items, x.(mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := h.items
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return item
+}
+
+// Esegue il merge k-way delle run indicate chiamando emit per ogni record in ordine di chiave
+// (secondo il tipo kt). Restituisce un errore se una run non è ordinata.
+func MergeRuns(paths []string, kt KeyType, emit func(Record) error) error {
+	readers := make([]*RunReader, 0, len(paths))
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+
+	h := &mergeHeap{kt: kt}
+	for i, path := range paths {
+		reader, err := OpenRun(path)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, reader)
+
+		rec, ok, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Push(h, mergeItem{rec: rec, run: i})
+		}
+	}
+
+	for h.Len() > 0 {
+		item := heap.Pop(h).(mergeItem)
+		if err := emit(item.rec); err != nil {
+			return err
+		}
+
+		next, ok, err := readers[item.run].Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if kt.Compare(next.Key, item.rec.Key) < 0 {
+			return fmt.Errorf("run %s non ordinata: %s dopo %s", paths[item.run], next.Key, item.rec.Key)
+		}
+		heap.Push(h, mergeItem{rec: next, run: item.run})
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ========================================================================================
+// Shuffle su file: i mapper scrivono le partizioni su disco, nelle RPC viaggiano solo i descrittori
+// ========================================================================================
+
+// ShuffleSegment descrive i record di una partizione prodotti da un tentativo di Map, salvati
+// nel file di shuffle del mapper che li ha prodotti. Il reducer li legge con Worker.FetchPartition.
+type ShuffleSegment struct {
+	Source   string // Indirizzo del mapper che conserva il file
+	Path     string // Nome del file nella cartella di shuffle del mapper
+	Offset   int64  // Inizio del segmento nel file
+	Length   int64  // Lunghezza in byte del segmento
+	Checksum string // SHA-256 esadecimale del segmento
+	Records  int    // Record contenuti nel segmento
+}
+
+// Modalità di shuffle (settings.shuffle)
+const (
+	PushShuffle = "push" // Il mapper invia i descrittori ai reducer durante il MapTask (default)
+	PullShuffle = "pull" // Il mapper conserva i segmenti; il master li indica ai reducer, che li scaricano
+)
+
+// Indica se la modalità di shuffle è valida ("" equivale a push)
+func ValidShuffle(mode string) bool {
+	return mode == "" || mode == PushShuffle || mode == PullShuffle
+}
+
+// FetchPartitionRequest e FetchPartitionReply per leggere da un mapper un blocco di un segmento
+type FetchPartitionRequest struct {
+	Segment ShuffleSegment // Segmento da leggere
+	Offset  int64          // Posizione relativa all'inizio del segmento
+}
+
+type FetchPartitionReply struct {
+	Data []byte
+}
+
+// ShuffleSource è un segmento di una partizione prodotto dal tentativo accettato di un chunk
+type ShuffleSource struct {
+	ChunkID   int
+	AttemptID string
+	Segment   ShuffleSegment
+}
+
+// PullPartitionRequest e PullPartitionReply: il master indica al reducer i segmenti della partizione
+// conservati dai mapper (shuffle pull) e il reducer li scarica in parallelo
+type PullPartitionRequest struct {
+	JobID   string          // Job della partizione
+	Owner   string          // Owner della partizione
+	Sources []ShuffleSource // Segmenti da scaricare, uno per chunk
+}
+
+type PullPartitionReply struct {
+	Fetched int   // Segmenti scaricati
+	Skipped int   // Segmenti già presenti come run
+	Missing []int // Chunk il cui segmento non è stato ottenuto dal mapper
+}
+
+// Dimensione massima di un blocco letto con una singola RPC
+const ShuffleBlockSize = 1 << 20
+
+// Writer che conta i byte scritti e ne calcola lo SHA-256
+type segmentWriter struct {
+	w    io.Writer
+	sum  hash.Hash
+	size int64
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.sum.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+// ShuffleWriter riceve in streaming i record di ogni partizione, in file temporanei separati per
+// Owner, e li riunisce in un unico file di shuffle a fine Map: la memoria usata non dipende dalla
+// dimensione del chunk
+type ShuffleWriter struct {
+	dir      string
+	owners   []string
+	files    map[string]*os.File
+	writers  map[string]*bufio.Writer
+	encoders map[string]*json.Encoder
+	counts   map[string]int
+}
+
+// Crea uno ShuffleWriter che usa dir per i file temporanei
+func NewShuffleWriter(dir string, owners []string) (*ShuffleWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ShuffleWriter{
+		dir:      dir,
+		owners:   owners,
+		files:    make(map[string]*os.File),
+		writers:  make(map[string]*bufio.Writer),
+		encoders: make(map[string]*json.Encoder),
+		counts:   make(map[string]int),
+	}, nil
+}
+
+// Aggiunge un record alla partizione di owner (i record di una partizione vanno scritti in ordine)
+func (s *ShuffleWriter) Write(owner string, r Record) error {
+	encoder, ok := s.encoders[owner]
+	if !ok {
+		file, err := os.CreateTemp(s.dir, "part_*.jsonl")
+		if err != nil {
+			return err
+		}
+		s.files[owner] = file
+		s.writers[owner] = bufio.NewWriter(file)
+		encoder = json.NewEncoder(s.writers[owner])
+		s.encoders[owner] = encoder
+	}
+	s.counts[owner]++
+	return encoder.Encode(r)
+}
+
+// Scrive in path, nell'ordine degli owner, i record di ogni partizione (un record JSON per riga,
+// come le run) e restituisce il descrittore del segmento di ogni Owner, senza Source.
+// Le partizioni vuote non hanno segmento.
+func (s *ShuffleWriter) Finish(path string) (map[string]ShuffleSegment, error) {
+	segments := make(map[string]ShuffleSegment)
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		var offset int64
+		for _, owner := range s.owners {
+			file := s.files[owner]
+			if file == nil {
+				continue
+			}
+			if err := s.writers[owner].Flush(); err != nil {
+				return err
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			sw := &segmentWriter{w: w, sum: sha256.New()}
+			if _, err := io.Copy(sw, file); err != nil {
+				return err
+			}
+			segments[owner] = ShuffleSegment{
+				Path:     filepath.Base(path),
+				Offset:   offset,
+				Length:   sw.size,
+				Checksum: hex.EncodeToString(sw.sum.Sum(nil)),
+				Records:  s.counts[owner],
+			}
+			offset += sw.size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+// Rimuove i file temporanei
+func (s *ShuffleWriter) Close() error {
+	for _, file := range s.files {
+		file.Close()
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// Scrive in un unico file i record di ogni partizione (vedi ShuffleWriter.Finish)
+func WriteShuffleFile(path string, owners []string, parts map[string][]Record) (map[string]ShuffleSegment, error) {
+	writer, err := NewShuffleWriter(path+".parts", owners)
+	if err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+	for _, owner := range owners {
+		for _, r := range parts[owner] {
+			if err := writer.Write(owner, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return writer.Finish(path)
+}
+
+// Tempo massimo di connessione e di risposta a ogni lettura di un segmento: un mapper bloccato
+// fa fallire la consegna invece di tenere occupato il reducer
+var (
+	SegmentDialTimeout = 3 * time.Second
+	SegmentCallTimeout = 30 * time.Second
+)
+
+// Legge un segmento dal mapper che lo conserva (RPC Worker.FetchPartition) e lo salva in dest come
+// run, in modo atomico: il file viene creato solo se lunghezza e checksum corrispondono al descrittore
+func PullSegment(seg ShuffleSegment, dest string) error {
+	conn, err := net.DialTimeout("tcp", seg.Source, SegmentDialTimeout)
+	if err != nil {
+		return fmt.Errorf("mapper %s non raggiungibile: %v", seg.Source, err)
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	return writeFileAtomic(dest, func(w io.Writer) error {
+		sw := &segmentWriter{w: w, sum: sha256.New()}
+		for sw.size < seg.Length {
+			req := FetchPartitionRequest{Segment: seg, Offset: sw.size}
+			var reply FetchPartitionReply
+			call := client.Go("Worker.FetchPartition", req, &reply, make(chan *rpc.Call, 1))
+			select {
+			case <-call.Done:
+			case <-time.After(SegmentCallTimeout):
+				// Chiude la connessione e attende la fine della chiamata prima di abbandonare reply
+				client.Close()
+				<-call.Done
+				return fmt.Errorf("lettura di %s da %s: nessuna risposta entro %v", seg.Path, seg.Source, SegmentCallTimeout)
+			}
+			if err := call.Error; err != nil {
+				return fmt.Errorf("lettura di %s da %s: %v", seg.Path, seg.Source, err)
+			}
+			if len(reply.Data) == 0 {
+				return fmt.Errorf("segmento di %s troncato: %d byte su %d", seg.Path, sw.size, seg.Length)
+			}
+			if _, err := sw.Write(reply.Data); err != nil {
+				return err
+			}
+		}
+		if sum := hex.EncodeToString(sw.sum.Sum(nil)); sw.size != seg.Length || sum != seg.Checksum {
+			return fmt.Errorf("segmento di %s corrotto: checksum %s, atteso %s", seg.Path, sum, seg.Checksum)
+		}
+		return nil
+	})
+}
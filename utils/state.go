@@ -1,16 +1,53 @@
 package utils
 
 import (
-	"encoding/json"
+	"fmt"
 	"log"
-	"os"
-	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
-	"fmt"
 )
 
-var statusMu sync.Mutex
+// Chiavi dei file di stato comuni a tutti i job
+const (
+	completedPath = "state/completed.json"
+	workersPath   = "state/workers.json"
+	jobsPrefix    = "state/jobs/"
+)
+
+// Nomi dei file di stato di un job, relativi alla sua cartella state/jobs/<id>/
+const (
+	statusName    = "status.json"
+	dataName      = "data.json"
+	chunksName    = "chunks.json"
+	partitionName = "partition.json"
+	jobName       = "job.json"
+	resultName    = "result.json"
+	walName       = "wal/"
+)
+
+// JobState raccoglie i file di stato di un job in state/jobs/<id>/: job concorrenti
+// o successivi non condividono tabella dei task, chunk né partizionamento
+type JobState struct {
+	ID     string
+	prefix string
+	mu     sync.Mutex // per accesso concorrente alla tabella dei task e al partizionamento
+
+	// Stato in memoria del log dei task
+	loaded  bool
+	table   TaskTable
+	pending int // Eventi scritti dall'ultima compattazione
+}
+
+// Crea il namespace dei file di stato del job
+func NewJobState(id string) *JobState {
+	return &JobState{ID: id, prefix: jobsPrefix + id + "/"}
+}
+
+// Chiave di un file di stato del job
+func (s *JobState) key(name string) string {
+	return s.prefix + name
+}
 
 /* -------------------------------------------------------------
 		ALTRO
@@ -18,62 +55,16 @@ var statusMu sync.Mutex
 
 // Salva un flag JSON che indica il completamento con successo dell’esecuzione
 func SaveCompletionFlag() {
-	os.MkdirAll("state", os.ModePerm)
-	filePath := "state/completed.json"
-
-	// Usa Create + Write + Sync per garantire flush su disco
-	f, err := os.Create(filePath)
-	if err != nil {
-		log.Printf("Errore creazione completed.json: %v", err)
-		return
-	}
-
-	_, err = f.Write([]byte(`{"completed": true}`))
-	if err != nil {
+	if err := writeStateJSON(completedPath, map[string]bool{"completed": true}); err != nil {
 		log.Printf("Errore scrittura completed.json: %v", err)
+		return
 	}
-
-	if err := f.Sync(); err != nil {
-		log.Printf("Errore sync completed.json: %v", err)
-	}
-
-	f.Close()
-	log.Println("[STATE] Flag completamento salvato e flushato su disco.")
-
-	// Upload su S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := fmt.Sprintf("s3://%s/state/completed.json", bucket)
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload completed.json su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("Upload completed.json su S3 riuscito: %s", s3Path)
-		}
-	}
+	log.Println("[STATE] Flag completamento salvato.")
 }
 
-
 // Controlla se esiste il file di completamento
 func CompletionFlagExists() bool {
-	filePath := "state/completed.json"
-
-	// Scarica da S3 se attivo
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := fmt.Sprintf("s3://%s/state/completed.json", bucket)
-		cmd := exec.Command("aws", "s3", "cp", s3Path, filePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore download completed.json da S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Println("[STATE] Scaricato completed.json da S3")
-		}
-	}
-
-	// Controlla in locale
-	_, err := os.Stat(filePath)
+	_, err := Store().Get(completedPath)
 	if err == nil {
 		log.Println("[STANDBY] completed.json rilevato correttamente")
 	} else {
@@ -82,237 +73,141 @@ func CompletionFlagExists() bool {
 	return err == nil
 }
 
-
 // Elimina il file di completamento
 func RemoveCompletionFlag() {
-	filePath := "state/completed.json"
-
-	// Rimozione locale
-	if err := os.Remove(filePath); err == nil {
-		log.Println("[STATE] completed.json rimosso")
-	} else if !os.IsNotExist(err) {
+	if err := Store().Delete(completedPath); err != nil {
 		log.Printf("Errore rimozione completed.json: %v", err)
+		return
 	}
-
-	// Rimozione da S3
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := fmt.Sprintf("s3://%s/state/completed.json", bucket)
-		cmd := exec.Command("aws", "s3", "rm", s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore rimozione completed.json da S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("completed.json rimosso da S3: %s", s3Path)
-		}
-	}
+	log.Println("[STATE] completed.json rimosso")
 }
 
-// Elimina tutti i file di stato
-func ResetState() {
-	// Elenco dei file locali da rimuovere
-	files := []string{
-		"state/status.json",
-		"state/data.json",
-		"state/chunks.json",
-		"state/workers.json", 
-	}
-
-	for _, filePath := range files {
-		if err := os.Remove(filePath); err == nil {
-			log.Printf("[STATE] File %s rimosso", filePath)
-		} else if !os.IsNotExist(err) {
-			log.Printf("Errore durante la rimozione di %s: %v", filePath, err)
-		}
-	}
-
-	// Rimuovi da S3 se attivo
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		for _, name := range []string{"status.json", "data.json", "chunks.json", "workers.json"} {
-			s3Path := fmt.Sprintf("s3://%s/state/%s", bucket, name)
-			cmd := exec.Command("aws", "s3", "rm", s3Path)
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				log.Printf("Errore rimozione %s da S3: %v\nOutput: %s", s3Path, err, string(output))
-			} else {
-				log.Printf("File rimosso da S3: %s", s3Path)
-			}
-		}
-	}
-
+// Elimina i file di stato del job tranne job.json e result.json, che restano per lo storico
+func (s *JobState) Reset() {
+	s.removeKeys(func(name string) bool { return name != jobName && name != resultName })
+	s.mu.Lock()
+	s.loaded = false
+	s.mu.Unlock()
 }
 
-// Salva i numeri generati in ./state/data.json e li carica su S3 se abilitato
-func SaveDataToFile(data []int) {
-	err := os.MkdirAll("state", os.ModePerm)
-	if err != nil {
-		log.Fatalf("Errore creazione cartella state/: %v", err)
-	}
-
-	filePath := "state/data.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		log.Fatalf("Errore creazione %s: %v", filePath, err)
-	}
-	defer file.Close()
+// Elimina tutti i file di stato del job (job rimosso dallo storico)
+func (s *JobState) Remove() {
+	s.removeKeys(func(string) bool { return true })
+	s.mu.Lock()
+	s.loaded = false
+	s.mu.Unlock()
+}
 
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(data)
+// Elimina i file di stato del job il cui nome soddisfa match
+func (s *JobState) removeKeys(match func(name string) bool) {
+	keys, err := Store().List(s.prefix)
 	if err != nil {
-		log.Fatalf("Errore scrittura JSON %s: %v", filePath, err)
+		log.Printf("Errore elenco di %s: %v", s.prefix, err)
+		return
 	}
-
-	log.Printf("[STATE] Dati salvati in %s", filePath)
-
-	// Upload S3 se richiesto
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := "s3://" + bucket + "/state/data.json"
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload su S3 (%s): %v\nOutput: %s", s3Path, err, string(output))
+	for _, key := range keys {
+		if !match(strings.TrimPrefix(key, s.prefix)) {
+			continue
+		}
+		if err := Store().Delete(key); err != nil {
+			log.Printf("Errore durante la rimozione di %s: %v", key, err)
 		} else {
-			log.Printf("Upload su S3 riuscito: %s", s3Path)
+			log.Printf("[STATE] File %s rimosso", key)
 		}
 	}
 }
 
-// Salva i chunk generati in ./state/chunks.json e li carica su S3 se abilitato
-func SaveChunksToFile(chunks [][]int) {
-	err := os.MkdirAll("state", os.ModePerm)
-	if err != nil {
-		log.Fatalf("Errore creazione cartella state/: %v", err)
-	}
-
-	filePath := "state/chunks.json"
-	file, err := os.Create(filePath)
+// Elenca gli ID dei job con un job.json salvato
+func ListJobStates() ([]string, error) {
+	keys, err := Store().List(jobsPrefix)
 	if err != nil {
-		log.Fatalf("Errore creazione %s: %v", filePath, err)
+		return nil, err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(chunks)
-	if err != nil {
-		log.Fatalf("Errore scrittura JSON %s: %v", filePath, err)
-	}
-
-	log.Printf("[STATE] Chunk salvati in %s", filePath)
-
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := "s3://" + bucket + "/state/chunks.json"
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload su S3 (%s): %v\nOutput: %s", s3Path, err, string(output))
-		} else {
-			log.Printf("Upload su S3 riuscito: %s", s3Path)
+	var ids []string
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, jobsPrefix)
+		if id, name, ok := strings.Cut(rest, "/"); ok && name == jobName {
+			ids = append(ids, id)
 		}
 	}
+	return ids, nil
 }
 
-// Inizializza il file status.json con lo stato "pending" per ogni chunk
-func InitStatusFile(nChunks int) {
-	err := os.MkdirAll("state", os.ModePerm)
-	if err != nil {
-		log.Fatalf("Errore creazione cartella state/: %v", err)
-	}
-
-	status := make(map[string]string)
-	for i := 0; i < nChunks; i++ {
-		status[strconv.Itoa(i)] = "pending"
+// Salva in job.json il job inviato, prima di accodarlo
+func (s *JobState) SaveJobInfo(info JobInfo) error {
+	if err := writeStateJSON(s.key(jobName), info); err != nil {
+		return err
 	}
+	log.Printf("[STATE] Job %s salvato in %s", info.ID, s.key(jobName))
+	return nil
+}
 
-	filePath := "state/status.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		log.Fatalf("Errore creazione %s: %v", filePath, err)
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(status)
-	if err != nil {
-		log.Fatalf("Errore scrittura JSON %s: %v", filePath, err)
+// Carica il job da job.json; ok è false se il job non è stato salvato
+func (s *JobState) LoadJobInfo() (info JobInfo, ok bool, err error) {
+	if err := readStateJSON(s.key(jobName), &info); err != nil {
+		if err == ErrNotFound {
+			return JobInfo{}, false, nil
+		}
+		return JobInfo{}, false, err
 	}
+	return info, true, nil
+}
 
-	log.Printf("[STATE] Stato inizializzato in %s", filePath)
+// Salva in result.json lo stato finale del job, conservato nello storico
+func (s *JobState) SaveResult(status JobStatus) error {
+	return writeStateJSON(s.key(resultName), status)
+}
 
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := "s3://" + bucket + "/state/status.json"
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload status.json su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("Upload su S3 riuscito: %s", s3Path)
+// Carica lo stato finale del job; ok è false se il job non è concluso
+func (s *JobState) LoadResult() (status JobStatus, ok bool, err error) {
+	if err := readStateJSON(s.key(resultName), &status); err != nil {
+		if err == ErrNotFound {
+			return JobStatus{}, false, nil
 		}
+		return JobStatus{}, false, err
 	}
+	return status, true, nil
 }
 
-// Aggiorna lo stato del chunk i-esimo a "done" in status.json
-func SaveStatusAfterChunk(i int) {
-
-	statusMu.Lock()
-	defer statusMu.Unlock()
-
-	filePath := "state/status.json"
-
-	// Leggi lo stato attuale
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Fatalf("Errore apertura %s: %v", filePath, err)
+// Salva i numeri generati in data.json
+func (s *JobState) SaveDataToFile(data []Record) error {
+	if err := writeStateJSON(s.key(dataName), data); err != nil {
+		return fmt.Errorf("scrittura JSON %s: %v", s.key(dataName), err)
 	}
-	defer file.Close()
+	log.Printf("[STATE] Dati salvati in %s", s.key(dataName))
+	return nil
+}
 
-	var status map[string]string
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&status)
-	if err != nil {
-		log.Fatalf("Errore decoding JSON %s: %v", filePath, err)
+// Salva i chunk in chunks.json (per i dati generati solo seed e dimensioni)
+func (s *JobState) SaveChunksToFile(chunks []ChunkData) error {
+	if err := writeStateJSON(s.key(chunksName), chunks); err != nil {
+		return fmt.Errorf("scrittura JSON %s: %v", s.key(chunksName), err)
 	}
+	log.Printf("[STATE] Chunk salvati in %s", s.key(chunksName))
+	return nil
+}
 
-	// Aggiorna lo stato
-	chunkID := strconv.Itoa(i)
-	status[chunkID] = "done"
-
-	// Riscrivi il file
-	fileOut, err := os.Create(filePath)
-	if err != nil {
-		log.Fatalf("Errore creazione %s: %v", filePath, err)
-	}
-	defer fileOut.Close()
+// Inizializza la tabella dei task (snapshot in status.json) con lo stato "pending" per ogni chunk.
+// I completamenti successivi vengono aggiunti al log dei task, senza riscrivere status.json.
+func (s *JobState) InitStatusFile(nChunks int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	encoder := json.NewEncoder(fileOut)
-	err = encoder.Encode(status)
-	if err != nil {
-		log.Fatalf("Errore scrittura JSON %s: %v", filePath, err)
+	table := newTaskTable()
+	for i := 0; i < nChunks; i++ {
+		table.Map[strconv.Itoa(i)] = &TaskStatus{State: TaskPending}
 	}
 
-	log.Printf("[STATE] Stato aggiornato: chunk %d → done", i)
-
-	// Upload su S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := "s3://" + bucket + "/state/status.json"
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload status.json su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("Upload su S3 riuscito: %s", s3Path)
-		}
+	if err := s.resetTaskTableLocked(table); err != nil {
+		return fmt.Errorf("scrittura JSON %s: %v", s.key(statusName), err)
 	}
+	log.Printf("[STATE] Stato inizializzato in %s", s.key(statusName))
+	return nil
 }
 
-// Controlla la presenza del file status.json
-func StateFilesExist() bool {
-	_, err := os.Stat("state/status.json")
-	return err == nil
+// Controlla la presenza dello snapshot status.json
+func (s *JobState) StateFilesExist() bool {
+	return stateExists(s.key(statusName))
 }
 
 /* -------------------------------------------------------------
@@ -321,200 +216,85 @@ func StateFilesExist() bool {
 
 // Verifica se esiste workers.json
 func WorkersFileExists() bool {
-	_, err := os.Stat("state/workers.json")
-	return err == nil
+	return stateExists(workersPath)
 }
 
 // Legge i worker salvati in workers.json e li restituisce
-func RecoverWorkersFromFile() []WorkerConfig {
-	file, err := os.Open("state/workers.json")
-	if err != nil {
-		log.Printf("Errore apertura workers.json: %v", err)
-		return nil
-	}
-	defer file.Close()
-
+func RecoverWorkersFromFile() ([]WorkerConfig, error) {
 	var workers []WorkerConfig
-	err = json.NewDecoder(file).Decode(&workers)
-	if err != nil {
-		log.Printf("Errore decoding workers.json: %v", err)
-		return nil
+	if err := readStateJSON(workersPath, &workers); err != nil {
+		return nil, err
 	}
-	return workers
+	return workers, nil
 }
 
 // Salva i worker registrati in workers.json
 func SaveWorkerOnRegister(workers []WorkerConfig) {
-	err := os.MkdirAll("state", os.ModePerm)
-	if err != nil {
-		log.Printf("Errore creazione cartella state/: %v", err)
-		return
-	}
-
-	filePath := "state/workers.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		log.Printf("Errore creazione workers.json: %v", err)
+	if err := writeStateJSON(workersPath, workers); err != nil {
+		log.Printf("Errore scrittura workers.json: %v", err)
 		return
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(workers); err != nil {
-		log.Printf("Errore encoding workers.json: %v", err)
-		return
-	}
-
 	log.Println("[STATE] workers.json salvato correttamente.")
-
-	// Upload S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := fmt.Sprintf("s3://%s/state/workers.json", bucket)
-		cmd := exec.Command("aws", "s3", "cp", filePath, s3Path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore upload workers.json su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("Upload workers.json su S3 riuscito: %s", s3Path)
-		}
-	}
 }
 
 /* -------------------------------------------------------------
 		(2) FASE MAP GIA' COMPLETATA
 -------------------------------------------------------------- */
 
-// Controlla se tutti i chunk nel file status.json sono "done"
-func PhaseAlreadyDone() bool {
-	filePath := "state/status.json"
-
-	// Se S3 abilitato, scarica la versione aggiornata
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		s3Path := "s3://" + bucket + "/state/status.json"
-		cmd := exec.Command("aws", "s3", "cp", s3Path, filePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("Errore download status.json da S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Printf("[STATE] Scaricato status.json aggiornato da S3")
-		}
-	}
-
-	if !StateFilesExist() {
-		log.Println("[STATE] Nessun file di stato trovato: skip PhaseAlreadyDone.")
-		return false
-	}
-
-	// Apre il file locale
-	file, err := os.Open(filePath)
+// Controlla se tutti i chunk nella tabella dei task sono "done";
+// un file di stato corrotto è un errore, non una fase "non completata"
+func (s *JobState) PhaseAlreadyDone() (bool, error) {
+	table, err := s.LoadTaskTable()
 	if err != nil {
-		log.Printf("Errore apertura %s: %v", filePath, err)
-		return false
+		return false, err
 	}
-	defer file.Close()
-
-	// Decodifica
-	var status map[string]string
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&status)
-	if err != nil {
-		log.Printf("Errore decoding JSON %s: %v", filePath, err)
-		return false
+	if len(table.Map) == 0 {
+		log.Println("[STATE] Nessun file di stato trovato: skip PhaseAlreadyDone.")
+		return false, nil
 	}
 
 	// Controlla se tutti sono "done"
-	for _, v := range status {
-		if v != "done" {
-			return false
+	for _, task := range table.Map {
+		if task.State != TaskDone {
+			return false, nil
 		}
 	}
-	return true
+	return true, nil
 }
 
 /* -------------------------------------------------------------
 		(3) FASE MAP INIZIATA E CHUNK PENDENTI
 -------------------------------------------------------------- */
 
-// Restituisce tutti i chunk marcati come "pending" nel file status.json
-func RecoverPendingChunks() [][]int {
-	statusMu.Lock()
-	defer statusMu.Unlock()
-
-	statusPath := "state/status.json"
-	chunksPath := "state/chunks.json"
-
-	// Scarica da S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-
-		// Prova a scaricare status.json
-		cmd := exec.Command("aws", "s3", "cp", fmt.Sprintf("s3://%s/state/status.json", bucket), statusPath)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("[RECOVERY] Warning: status.json non trovato su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Println("[RECOVERY] status.json scaricato da S3")
-		}
-
-		// Prova a scaricare chunks.json
-		cmd = exec.Command("aws", "s3", "cp", fmt.Sprintf("s3://%s/state/chunks.json", bucket), chunksPath)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("[RECOVERY] Warning: chunks.json non trovato su S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Println("[RECOVERY] chunks.json scaricato da S3")
-		}
-	}
-
-	// Verifica se i file esistono localmente
-	if _, err := os.Stat(statusPath); os.IsNotExist(err) {
-		log.Println("[RECOVERY] Stato assente: nessun chunk pending da recuperare.")
-		return [][]int{}
-	}
-
-	if _, err := os.Stat(chunksPath); os.IsNotExist(err) {
-		log.Println("[RECOVERY] Errore: chunks.json assente. Recovery impossibile.")
-		return [][]int{}
-	}
-
-	// Decodifica status.json
-	statusFile, err := os.Open(statusPath)
+// Restituisce tutti i chunk non ancora "done" nella tabella dei task, con il loro ID originale
+func (s *JobState) RecoverPendingChunks() ([]Chunk, error) {
+	table, err := s.LoadTaskTable()
 	if err != nil {
-		log.Printf("[RECOVERY] Errore apertura %s: %v", statusPath, err)
-		return [][]int{}
-	}
-	defer statusFile.Close()
-
-	var status map[string]string
-	if err := json.NewDecoder(statusFile).Decode(&status); err != nil {
-		log.Printf("[RECOVERY] Errore decoding status.json: %v", err)
-		return [][]int{}
+		return nil, err
 	}
-
-	// Decodifica chunks.json
-	chunksFile, err := os.Open(chunksPath)
-	if err != nil {
-		log.Printf("[RECOVERY] Errore apertura %s: %v", chunksPath, err)
-		return [][]int{}
+	if len(table.Map) == 0 {
+		log.Println("[RECOVERY] Stato assente: nessun chunk pending da recuperare.")
+		return []Chunk{}, nil
 	}
-	defer chunksFile.Close()
 
-	var chunks [][]int
-	if err := json.NewDecoder(chunksFile).Decode(&chunks); err != nil {
-		log.Printf("[RECOVERY] Errore decoding chunks.json: %v", err)
-		return [][]int{}
+	var chunks []ChunkData
+	if err := readStateJSON(s.key(chunksName), &chunks); err != nil {
+		if err == ErrNotFound {
+			return nil, fmt.Errorf("chunks.json assente, recovery impossibile")
+		}
+		return nil, err
 	}
 
 	// Estrai i pending
-	var pending [][]int
+	var pending []Chunk
 	for i, chunk := range chunks {
-		if status[strconv.Itoa(i)] == "pending" {
-			pending = append(pending, chunk)
+		if task := table.Map[strconv.Itoa(i)]; task == nil || task.State != TaskDone {
+			pending = append(pending, Chunk{ID: i, Data: chunk})
 		}
 	}
 
 	log.Printf("[RECOVERY] Trovati %d chunk pending", len(pending))
-	return pending
+	return pending, nil
 }
 
 /* -------------------------------------------------------------
@@ -522,46 +302,21 @@ func RecoverPendingChunks() [][]int {
 -------------------------------------------------------------- */
 
 // Controlla se il file data.json esiste
-func DataFileExists() bool {
-	_, err := os.Stat("state/data.json")
-	return err == nil
+func (s *JobState) DataFileExists() bool {
+	return stateExists(s.key(dataName))
 }
 
-// Carica i dati da data.json
-func LoadDataFromFile() []int {
-	filePath := "state/data.json"
-
-	// Scarica da S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		cmd := exec.Command("aws", "s3", "cp", fmt.Sprintf("s3://%s/state/data.json", bucket), filePath)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			log.Printf("[RECOVERY] Warning: errore download data.json da S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Println("[RECOVERY] data.json scaricato da S3")
+// Carica i dati da data.json (vuoti se il file non esiste)
+func (s *JobState) LoadDataFromFile() ([]Record, error) {
+	var data []Record
+	if err := readStateJSON(s.key(dataName), &data); err != nil {
+		if err == ErrNotFound {
+			log.Println("[RECOVERY] data.json non esistente. Ritorno vuoto.")
+			return []Record{}, nil
 		}
+		return nil, err
 	}
-
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Println("[RECOVERY] data.json non esistente. Ritorno vuoto.")
-		return []int{}
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("Errore apertura %s: %v", filePath, err)
-		return []int{}
-	}
-	defer file.Close()
-
-	var data []int
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&data)
-	if err != nil {
-		log.Printf("Errore decoding JSON %s: %v", filePath, err)
-		return []int{}
-	}
-	return data
+	return data, nil
 }
 
 /* -------------------------------------------------------------
@@ -569,39 +324,15 @@ func LoadDataFromFile() []int {
 -------------------------------------------------------------- */
 
 // Controlla la presenza di chunks.json
-func ChunkFileExists() bool {
-	_, err := os.Stat("state/chunks.json")
-	return err == nil
+func (s *JobState) ChunkFileExists() bool {
+	return stateExists(s.key(chunksName))
 }
 
 // Carica i chunk da chunks.json
-func LoadChunksFromFile() [][]int {
-	filePath := "state/chunks.json"
-
-	// Scarica da S3 se abilitato
-	if os.Getenv("ENABLE_S3") == "true" {
-		bucket := os.Getenv("S3_BUCKET")
-		cmd := exec.Command("aws", "s3", "cp", fmt.Sprintf("s3://%s/state/chunks.json", bucket), filePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("[RECOVERY] Warning: errore download chunks.json da S3: %v\nOutput: %s", err, string(output))
-		} else {
-			log.Println("[RECOVERY] chunks.json scaricato da S3")
-		}
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Printf("Errore apertura %s: %v", filePath, err)
-		return [][]int{}
+func (s *JobState) LoadChunksFromFile() ([]ChunkData, error) {
+	var chunks []ChunkData
+	if err := readStateJSON(s.key(chunksName), &chunks); err != nil {
+		return nil, err
 	}
-	defer file.Close()
-
-	var chunks [][]int
-	if err := json.NewDecoder(file).Decode(&chunks); err != nil {
-		log.Printf("Errore decoding chunks.json: %v", err)
-		return [][]int{}
-	}
-	return chunks
+	return chunks, nil
 }
-
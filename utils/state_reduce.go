@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+)
+
+/* -------------------------------------------------------------
+		FASE REDUCE: STATO DELLE PARTIZIONI
+-------------------------------------------------------------- */
+
+// Versione corrente del formato dei file di stato
+const stateSchemaVersion = 1
+
+// ErrCorruptState indica un file di stato illeggibile, troncato o con checksum errato
+var ErrCorruptState = errors.New("file di stato corrotto")
+
+// Busta di ogni file di stato: versione dello schema e checksum SHA-256 del contenuto
+type stateEnvelope struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Checksum      string          `json:"checksum"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Scrive un valore JSON in un file di stato tramite lo StateStore, dentro la busta con checksum
+func writeStateJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	envelope, err := json.Marshal(stateEnvelope{
+		SchemaVersion: stateSchemaVersion,
+		Checksum:      sha256Hex(data),
+		Data:          data,
+	})
+	if err != nil {
+		return err
+	}
+	return Store().Put(key, append(envelope, '\n'))
+}
+
+// Legge un file di stato JSON; restituisce ErrNotFound se assente ed ErrCorruptState
+// se la busta non è valida, la versione non è supportata o il checksum non corrisponde
+func readStateJSON(key string, v interface{}) error {
+	raw, err := Store().Get(key)
+	if err != nil {
+		return err
+	}
+
+	var envelope stateEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("%s: %w (%v)", key, ErrCorruptState, err)
+	}
+	if envelope.SchemaVersion == 0 || envelope.Data == nil {
+		return fmt.Errorf("%s: %w (busta o versione dello schema mancante)", key, ErrCorruptState)
+	}
+	if envelope.SchemaVersion > stateSchemaVersion {
+		return fmt.Errorf("%s: versione dello schema %d non supportata (massima %d)", key, envelope.SchemaVersion, stateSchemaVersion)
+	}
+
+	// Il checksum è calcolato sul JSON compatto, indipendente dalla formattazione
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, envelope.Data); err != nil {
+		return fmt.Errorf("%s: %w (%v)", key, ErrCorruptState, err)
+	}
+	if sum := sha256Hex(compact.Bytes()); sum != envelope.Checksum {
+		return fmt.Errorf("%s: %w (checksum %s, atteso %s)", key, ErrCorruptState, sum, envelope.Checksum)
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		return fmt.Errorf("%s: %w (%v)", key, ErrCorruptState, err)
+	}
+	return nil
+}
+
+// Indica se un file di stato esiste nello StateStore
+func stateExists(key string) bool {
+	_, err := Store().Get(key)
+	return err == nil
+}
+
+// Aggiunge alla tabella dei task le partizioni di Reduce in stato "pending", se non già presenti
+func (s *JobState) InitReduceStatusFile(owners []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTaskLogLocked(); err != nil {
+		return fmt.Errorf("lettura della tabella dei task: %v", err)
+	}
+	if len(s.table.Reduce) > 0 {
+		log.Printf("[STATE] Partizioni di Reduce già presenti: riprendo la fase di Reduce")
+		return nil
+	}
+
+	// Snapshot con le partizioni: gli eventi successivi partono da qui
+	for _, owner := range owners {
+		s.table.Reduce[owner] = &TaskStatus{State: TaskPending}
+	}
+	if err := s.compactTaskLogLocked(); err != nil {
+		return fmt.Errorf("scrittura %s: %v", s.key(statusName), err)
+	}
+	log.Printf("[STATE] Stato Reduce inizializzato in %s", s.key(statusName))
+	return nil
+}
+
+// Registra lo stato della partizione di un Owner nel log dei task
+func (s *JobState) SaveReduceStatus(owner string, state string) error {
+	ev := TaskEvent{Kind: ReduceTaskKind, Task: owner, State: state}
+	if err := s.appendTaskEvent(ev); err != nil {
+		return fmt.Errorf("registrazione stato Reduce di %s: %v", owner, err)
+	}
+	log.Printf("[STATE] Stato Reduce aggiornato: %s → %s", owner, state)
+	return nil
+}
+
+// Restituisce gli Owner la cui partizione non è ancora "done"
+func (s *JobState) RecoverPendingPartitions() ([]string, error) {
+	table, err := s.LoadTaskTable()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for owner, task := range table.Reduce {
+		if task.State != TaskDone {
+			pending = append(pending, owner)
+		}
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
+// Restituisce, per ogni Owner, il totale dei record consegnati dai chunk completati e il numero di chunk
+func (s *JobState) LoadShuffleCounts() (perOwner map[string]int, chunks int, err error) {
+	table, err := s.LoadTaskTable()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	perOwner = make(map[string]int)
+	for _, task := range table.Map {
+		if task.State != TaskDone {
+			continue
+		}
+		chunks++
+		for owner, n := range task.Sent {
+			perOwner[owner] += n
+		}
+	}
+	return perOwner, chunks, nil
+}
+
+// Restituisce il tentativo accettato per ogni chunk completato
+func (s *JobState) LoadAcceptedAttempts() (map[int]string, error) {
+	table, err := s.LoadTaskTable()
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := make(map[int]string)
+	for id, task := range table.Map {
+		chunkID, err := strconv.Atoi(id)
+		if err != nil || task.State != TaskDone {
+			continue
+		}
+		accepted[chunkID] = task.AttemptID
+	}
+	return accepted, nil
+}
+
+// Restituisce, per i chunk completati che hanno consegnato record all'Owner, il tentativo accettato:
+// sono i chunk da rieseguire se la partizione va ricostruita su un altro reducer
+func (s *JobState) LoadPartitionSources(owner string) (map[int]string, error) {
+	table, err := s.LoadTaskTable()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[int]string)
+	for id, task := range table.Map {
+		chunkID, err := strconv.Atoi(id)
+		if err != nil || task.State != TaskDone || task.Sent[owner] == 0 {
+			continue
+		}
+		sources[chunkID] = task.AttemptID
+	}
+	return sources, nil
+}
+
+// Restituisce, in ordine di chunk, i segmenti della partizione dell'Owner prodotti dai tentativi
+// accettati (shuffle pull). Un chunk senza segmento registrato ha Segment vuoto: il reducer lo
+// segnala come mancante e il master riesegue il chunk.
+func (s *JobState) LoadPartitionSegments(owner string) ([]ShuffleSource, error) {
+	table, err := s.LoadTaskTable()
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []ShuffleSource
+	for id, task := range table.Map {
+		chunkID, err := strconv.Atoi(id)
+		if err != nil || task.State != TaskDone || task.Sent[owner] == 0 {
+			continue
+		}
+		sources = append(sources, ShuffleSource{ChunkID: chunkID, AttemptID: task.AttemptID, Segment: task.Segments[owner]})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].ChunkID < sources[j].ChunkID })
+	return sources, nil
+}
+
+/* -------------------------------------------------------------
+		PARTIZIONAMENTO
+-------------------------------------------------------------- */
+
+// Salva il partizionamento calcolato, così ogni recovery usa gli stessi confini dei chunk già completati
+func (s *JobState) SavePartitionSpec(spec PartitionSpec) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeStateJSON(s.key(partitionName), spec); err != nil {
+		return fmt.Errorf("scrittura %s: %v", s.key(partitionName), err)
+	}
+	log.Printf("[STATE] Partizionamento salvato in %s", s.key(partitionName))
+	return nil
+}
+
+// Carica il partizionamento salvato; ok è false se non è mai stato calcolato
+func (s *JobState) LoadPartitionSpec() (spec PartitionSpec, ok bool, err error) {
+	if err := readStateJSON(s.key(partitionName), &spec); err != nil {
+		if err == ErrNotFound {
+			return PartitionSpec{}, false, nil
+		}
+		return PartitionSpec{}, false, err
+	}
+	return spec, len(spec.Reducers) > 0, nil
+}
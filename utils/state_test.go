@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Usa uno store locale in una cartella temporanea per la durata del test
+func useTempStore(t *testing.T) *LocalStore {
+	t.Helper()
+	previous := Store()
+	store := &LocalStore{Root: t.TempDir()}
+	SetStore(store)
+	t.Cleanup(func() { SetStore(previous) })
+	return store
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	useTempStore(t)
+	js := NewJobState("job-1")
+
+	js.SaveChunksToFile(RecordChunks([][]Record{IntsToRecords([]int{1, 2}), IntsToRecords([]int{3})}))
+	js.InitStatusFile(2)
+	js.RecordMapDone(0, "a1", "mapper:1", map[string]int{"r1": 2}, nil)
+
+	done, err := js.PhaseAlreadyDone()
+	if err != nil || done {
+		t.Fatalf("PhaseAlreadyDone = %v, %v: atteso false", done, err)
+	}
+	pending, err := js.RecoverPendingChunks()
+	if err != nil || len(pending) != 1 || pending[0].ID != 1 {
+		t.Fatalf("RecoverPendingChunks = %v, %v", pending, err)
+	}
+
+	js.RecordMapDone(1, "a2", "mapper:2", map[string]int{"r1": 1}, nil)
+	if done, err := js.PhaseAlreadyDone(); err != nil || !done {
+		t.Fatalf("PhaseAlreadyDone = %v, %v: atteso true", done, err)
+	}
+}
+
+// I chunk generati si salvano come seed e dimensioni e, ricaricati, producono gli stessi valori;
+// chunks.json nel formato precedente (array di record per chunk) resta leggibile
+func TestGeneratedChunksRoundTrip(t *testing.T) {
+	useTempStore(t)
+	js := NewJobState("job-1")
+
+	planned := PlanGeneratedChunks(42, 25, 10, 5, 9)
+	if len(planned) != 3 || planned[2].Len() != 5 {
+		t.Fatalf("chunk pianificati = %d (ultimo da %d), attesi 3 (ultimo da 5)", len(planned), planned[len(planned)-1].Len())
+	}
+	js.SaveChunksToFile(planned)
+	loaded, err := js.LoadChunksFromFile()
+	if err != nil || len(loaded) != len(planned) {
+		t.Fatalf("LoadChunksFromFile = %v, %v", loaded, err)
+	}
+
+	values := func(c ChunkData) []string {
+		var keys []string
+		c.Each(func(r Record) error {
+			keys = append(keys, r.Key)
+			return nil
+		})
+		return keys
+	}
+	reservoir := NewReservoir(4, 1)
+	for i := range planned {
+		want, got := values(planned[i]), values(loaded[i])
+		if strings.Join(want, ",") != strings.Join(got, ",") {
+			t.Errorf("chunk %d rigenerato %v, atteso %v", i, got, want)
+		}
+		for _, key := range got {
+			if v, _ := strconv.Atoi(key); v < 5 || v > 9 {
+				t.Errorf("chunk %d: valore %s fuori da [5, 9]", i, key)
+			}
+			reservoir.Add(key)
+		}
+	}
+	if len(reservoir.Keys) != 4 || reservoir.Seen() != 25 {
+		t.Errorf("reservoir con %d chiavi su %d viste, attese 4 su 25", len(reservoir.Keys), reservoir.Seen())
+	}
+
+	var legacy []ChunkData
+	if err := json.Unmarshal([]byte(`[[{"key":"1"},{"key":"2"}],[{"key":"3"}]]`), &legacy); err != nil || len(legacy) != 2 || legacy[0].Len() != 2 {
+		t.Errorf("chunks.json precedente = %v, %v", legacy, err)
+	}
+}
+
+// Il job inviato sopravvive a un riavvio del master; a fine job restano solo job.json e l'esito
+func TestJobInfoRoundTrip(t *testing.T) {
+	useTempStore(t)
+	js := NewJobState("job-1")
+
+	if _, ok, err := js.LoadJobInfo(); ok || err != nil {
+		t.Fatalf("LoadJobInfo senza job = %v, %v", ok, err)
+	}
+	info := JobInfo{ID: "job-1", Settings: Settings{JobType: "wordcount", Count: 10, Shuffle: PullShuffle}}
+	if err := js.SaveJobInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	js.InitStatusFile(1)
+	other := NewJobState("job-2")
+	other.InitStatusFile(3)
+
+	loaded, ok, err := NewJobState("job-1").LoadJobInfo()
+	if err != nil || !ok || loaded.ID != info.ID || loaded.Settings.JobType != "wordcount" || loaded.Settings.Shuffle != PullShuffle {
+		t.Fatalf("LoadJobInfo = %+v, %v, %v", loaded, ok, err)
+	}
+	if ids, err := ListJobStates(); err != nil || len(ids) != 1 || ids[0] != "job-1" {
+		t.Fatalf("ListJobStates = %v, %v", ids, err)
+	}
+
+	if err := js.SaveResult(JobStatus{JobInfo: info, State: JobCompleted}); err != nil {
+		t.Fatal(err)
+	}
+	js.Reset()
+	if js.StateFilesExist() {
+		t.Error("status.json ancora presente dopo Reset")
+	}
+	if _, ok, err := js.LoadJobInfo(); !ok || err != nil {
+		t.Errorf("job.json rimosso da Reset: %v, %v", ok, err)
+	}
+	if result, ok, err := js.LoadResult(); !ok || err != nil || result.State != JobCompleted {
+		t.Errorf("LoadResult = %+v, %v, %v", result, ok, err)
+	}
+	// Lo stato degli altri job non viene toccato
+	if table, err := NewJobState("job-2").LoadTaskTable(); err != nil || len(table.Map) != 3 {
+		t.Errorf("tabella del job-2 = %v, %v", table.Map, err)
+	}
+
+	js.Remove()
+	if _, ok, err := js.LoadJobInfo(); ok || err != nil {
+		t.Errorf("job ancora presente dopo Remove: %v, %v", ok, err)
+	}
+}
+
+func TestStateLoadersReportCorruption(t *testing.T) {
+	store := useTempStore(t)
+	js := NewJobState("job-1")
+
+	js.SaveChunksToFile(RecordChunks([][]Record{IntsToRecords([]int{1, 2}), IntsToRecords([]int{3})}))
+	js.InitStatusFile(2)
+	good, err := store.Get(js.key(statusName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]byte{
+		"troncato":        good[:len(good)/2],
+		"checksum errato": bytes.Replace(good, []byte(`"pending"`), []byte(`"done"`), 1),
+		"senza busta":     []byte(`{"0":"done","1":"done"}`),
+	}
+	for name, content := range cases {
+		if err := store.Put(js.key(statusName), content); err != nil {
+			t.Fatal(err)
+		}
+		js = NewJobState(js.ID) // Simula il riavvio del master
+
+		if _, err := js.PhaseAlreadyDone(); !errors.Is(err, ErrCorruptState) {
+			t.Errorf("%s: PhaseAlreadyDone err = %v, atteso ErrCorruptState", name, err)
+		}
+		if _, err := js.RecoverPendingChunks(); !errors.Is(err, ErrCorruptState) {
+			t.Errorf("%s: RecoverPendingChunks err = %v, atteso ErrCorruptState", name, err)
+		}
+	}
+
+	if err := store.Put(js.key(chunksName), []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.LoadChunksFromFile(); !errors.Is(err, ErrCorruptState) {
+		t.Errorf("LoadChunksFromFile err = %v, atteso ErrCorruptState", err)
+	}
+}
+
+func TestTaskLogRebuildAfterRestart(t *testing.T) {
+	store := useTempStore(t)
+	js := NewJobState("job-1")
+
+	const chunks = walCompactEvery + 10
+	js.InitStatusFile(chunks)
+	for i := 0; i < chunks; i++ {
+		js.RecordMapEvent(i, TaskAssigned, "a"+strconv.Itoa(i), "", nil)
+		if i%2 == 0 {
+			js.RecordMapDone(i, "a"+strconv.Itoa(i), "mapper:1", map[string]int{"r1": 1}, nil)
+		} else {
+			js.RecordMapEvent(i, TaskFailed, "a"+strconv.Itoa(i), "mapper:2", errors.New("timeout"))
+		}
+	}
+	// Un tentativo perdente che fallisce dopo il completamento non riporta indietro il chunk
+	js.RecordMapEvent(0, TaskFailed, "b0", "mapper:2", errors.New("annullato"))
+
+	// La compattazione ha rimosso gli eventi inclusi nello snapshot
+	if keys, _ := store.List(js.key(walName)); len(keys) >= walCompactEvery {
+		t.Fatalf("%d eventi nel log: compattazione non eseguita", len(keys))
+	}
+
+	before, err := js.LoadTaskTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	js = NewJobState(js.ID) // Simula il riavvio del master
+	after, err := js.LoadTaskTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Seq != before.Seq || len(after.Map) != chunks {
+		t.Fatalf("tabella ricostruita: seq %d (attesa %d), %d task", after.Seq, before.Seq, len(after.Map))
+	}
+	for id, task := range before.Map {
+		if got := after.Map[id]; got.State != task.State || got.AttemptID != task.AttemptID {
+			t.Fatalf("chunk %s: %+v dopo il riavvio, atteso %+v", id, got, task)
+		}
+	}
+
+	pending, err := js.RecoverPendingChunks()
+	if err == nil {
+		t.Fatalf("RecoverPendingChunks senza chunks.json: %v, atteso errore", pending)
+	}
+	counts, done, err := js.LoadShuffleCounts()
+	if err != nil || done != chunks/2 || counts["r1"] != chunks/2 {
+		t.Fatalf("LoadShuffleCounts = %v, %d, %v", counts, done, err)
+	}
+	accepted, err := js.LoadAcceptedAttempts()
+	if err != nil || accepted[0] != "a0" || len(accepted) != chunks/2 {
+		t.Fatalf("LoadAcceptedAttempts: tentativo del chunk 0 = %q, %d chunk", accepted[0], len(accepted))
+	}
+}
+
+// Shuffle pull: un chunk rieseguito aggiorna la posizione dei segmenti senza cambiare il tentativo accettato
+func TestRecordMapSegmentsUpdatesDoneChunk(t *testing.T) {
+	useTempStore(t)
+	js := NewJobState("job-1")
+
+	js.InitStatusFile(1)
+	first := map[string]ShuffleSegment{
+		"r1": {Source: "mapper:1", Path: "c0.shuffle", Length: 10, Records: 2},
+		"r2": {Source: "mapper:1", Path: "c0.shuffle", Offset: 10, Length: 5, Records: 1},
+	}
+	js.RecordMapDone(0, "a1", "mapper:1", map[string]int{"r1": 2, "r2": 1}, first)
+	moved := ShuffleSegment{Source: "mapper:2", Path: "c0-bis.shuffle", Length: 10, Records: 2}
+	if err := js.RecordMapSegments(0, "a1", map[string]ShuffleSegment{"r1": moved}); err != nil {
+		t.Fatal(err)
+	}
+	// Segmenti di un altro tentativo (es. perdente dell'esecuzione speculativa) ignorati
+	if err := js.RecordMapSegments(0, "b1", map[string]ShuffleSegment{"r2": moved}); err != nil {
+		t.Fatal(err)
+	}
+
+	js = NewJobState(js.ID) // Simula il riavvio del master
+	for owner, want := range map[string]ShuffleSegment{"r1": moved, "r2": first["r2"]} {
+		sources, err := js.LoadPartitionSegments(owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sources) != 1 || sources[0].AttemptID != "a1" || sources[0].Segment != want {
+			t.Errorf("%s: segmenti %+v, atteso %+v", owner, sources, want)
+		}
+	}
+}
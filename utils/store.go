@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ========================================================================================
+// StateStore: archivio chiave/valore dei file di stato
+// ========================================================================================
+
+// ErrNotFound è restituito da Get quando la chiave non esiste
+var ErrNotFound = errors.New("chiave non trovata")
+
+// StateStore astrae dove vengono salvati i file di stato (disco locale, S3, ...).
+// Le chiavi sono percorsi relativi con "/" come separatore (es. state/status.json).
+type StateStore interface {
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	Delete(key string) error                                  // Nessun errore se la chiave non esiste
+	List(prefix string) ([]string, error)                     // Chiavi con il prefisso dato, in ordine
+	CompareAndSwap(key string, old, new []byte) (bool, error) // old nil = crea solo se assente
+}
+
+var (
+	storeOnce   sync.Once
+	activeStore StateStore
+)
+
+// Store restituisce lo StateStore in uso, creandolo dalle variabili d'ambiente al primo utilizzo
+func Store() StateStore {
+	storeOnce.Do(func() {
+		if activeStore == nil {
+			activeStore = NewStateStoreFromEnv()
+		}
+	})
+	return activeStore
+}
+
+// SetStore sostituisce lo StateStore in uso (es. nei test o per un backend personalizzato).
+// I JobState creati prima conservano in memoria la tabella dei task letta dallo store precedente.
+func SetStore(s StateStore) {
+	storeOnce.Do(func() {})
+	activeStore = s
+}
+
+// Crea lo store dalle variabili d'ambiente: disco locale e, con ENABLE_S3=true, copia su S3
+func NewStateStoreFromEnv() StateStore {
+	local := &LocalStore{Root: "."}
+	if os.Getenv("ENABLE_S3") != "true" {
+		return local
+	}
+
+	s3, err := NewS3StoreFromEnv()
+	if err != nil {
+		log.Printf("[STATE] S3 non configurato correttamente (%v): uso solo il disco locale", err)
+		return local
+	}
+	return &MirrorStore{Local: local, Remote: s3}
+}
+
+// ========================================================================================
+// LocalStore: file su disco
+// ========================================================================================
+
+// LocalStore salva ogni chiave come file sotto Root
+type LocalStore struct {
+	Root string
+	mu   sync.Mutex // Serializza CompareAndSwap nello stesso processo (tra processi: flock)
+}
+
+func (l *LocalStore) path(key string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(key))
+}
+
+func (l *LocalStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put scrive in modo atomico: un crash a metà scrittura lascia intatta la versione precedente
+func (l *LocalStore) Put(key string, data []byte) error {
+	return writeFileAtomic(l.path(key), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Delete rimuove anche le cartelle rimaste vuote (es. state/jobs/<id>/ dopo l'ultimo file del job),
+// tranne quella di primo livello
+func (l *LocalStore) Delete(key string) error {
+	err := os.Remove(l.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for dir := path.Dir(key); path.Dir(dir) != "." && dir != "/"; dir = path.Dir(dir) {
+		if os.Remove(l.path(dir)) != nil {
+			break // Non vuota
+		}
+	}
+	return nil
+}
+
+func (l *LocalStore) List(prefix string) ([]string, error) {
+	var keys []string
+	root := filepath.Clean(l.Root)
+
+	// Visita solo la cartella che contiene il prefisso, non tutta la radice
+	start := root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = filepath.Join(root, filepath.FromSlash(prefix[:i]))
+	}
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		// I file temporanei di scritture interrotte non sono chiavi
+		if strings.HasPrefix(key, prefix) && !strings.Contains(d.Name(), ".tmp-") {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (l *LocalStore) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lock(key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := l.Get(key)
+	switch {
+	case err == ErrNotFound:
+		if old != nil {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	case old == nil || !bytes.Equal(current, old):
+		return false, nil
+	}
+	return true, l.Put(key, new)
+}
+
+// Lock esclusivo tra processi sulla chiave (es. master e standby sulla stessa cartella di stato),
+// su un file accanto alla chiave che List ignora come temporaneo
+func (l *LocalStore) lock(key string) (func(), error) {
+	lockPath := l.path(key) + ".tmp-lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// ========================================================================================
+// MirrorStore: disco locale + copia remota
+// ========================================================================================
+
+// MirrorStore scrive sia in locale sia sul backend remoto e legge preferendo il remoto,
+// ripiegando sulla copia locale se il remoto non risponde o non ha la chiave.
+// Una scrittura riesce solo se arriva sul remoto: è la copia letta dallo standby dopo il failover.
+type MirrorStore struct {
+	Local  StateStore
+	Remote StateStore
+}
+
+func (m *MirrorStore) Get(key string) ([]byte, error) {
+	data, err := m.Remote.Get(key)
+	if err == nil {
+		// Aggiorna la copia locale con la versione remota
+		if putErr := m.Local.Put(key, data); putErr != nil {
+			log.Printf("[STATE] Errore aggiornamento copia locale di %s: %v", key, putErr)
+		}
+		return data, nil
+	}
+	if err != ErrNotFound {
+		log.Printf("[STATE] Warning: lettura remota di %s fallita: %v", key, err)
+	}
+	return m.Local.Get(key)
+}
+
+func (m *MirrorStore) Put(key string, data []byte) error {
+	if err := m.Local.Put(key, data); err != nil {
+		return err
+	}
+	if err := m.Remote.Put(key, data); err != nil {
+		return fmt.Errorf("upload remoto di %s: %w", key, err)
+	}
+	return nil
+}
+
+// Con la rimozione remota fallita la chiave resta anche in locale, così le due copie restano uguali
+func (m *MirrorStore) Delete(key string) error {
+	if err := m.Remote.Delete(key); err != nil {
+		return fmt.Errorf("rimozione remota di %s: %w", key, err)
+	}
+	return m.Local.Delete(key)
+}
+
+func (m *MirrorStore) List(prefix string) ([]string, error) {
+	seen := make(map[string]bool)
+	remote, err := m.Remote.List(prefix)
+	if err != nil {
+		log.Printf("[STATE] Warning: elenco remoto di %s fallito: %v", prefix, err)
+	}
+	local, localErr := m.Local.List(prefix)
+	if localErr != nil {
+		return nil, localErr
+	}
+
+	var keys []string
+	for _, key := range append(remote, local...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Il remoto è la copia autorevole per il compare-and-swap; a successo si aggiorna il locale
+func (m *MirrorStore) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	swapped, err := m.Remote.CompareAndSwap(key, old, new)
+	if err != nil || !swapped {
+		return swapped, err
+	}
+	if err := m.Local.Put(key, new); err != nil {
+		log.Printf("[STATE] Errore aggiornamento copia locale di %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// ========================================================================================
+// Scrittura atomica
+// ========================================================================================
+
+// Scrive un file tramite file temporaneo univoco + fsync + rename (e fsync della cartella),
+// così chi legge vede sempre o la versione precedente o quella nuova completa
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	fail := func(err error) error {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	if err := write(writer); err != nil {
+		return fail(err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := file.Chmod(0644); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Rende persistente anche la voce della cartella (rename)
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ========================================================================================
+// S3Store: client HTTP nativo del protocollo S3 (firma AWS SigV4)
+// ========================================================================================
+
+// S3Store salva le chiavi come oggetti di un bucket S3 (o compatibile, es. MinIO)
+type S3Store struct {
+	Bucket       string
+	Region       string
+	Endpoint     string // Vuoto = endpoint AWS del bucket; altrimenti path-style (endpoint/bucket/key)
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+
+	now func() time.Time // Sostituibile nei test
+}
+
+// Crea lo store S3 da S3_BUCKET, AWS_REGION, S3_ENDPOINT e dalle credenziali AWS_*
+func NewS3StoreFromEnv() (*S3Store, error) {
+	s := &S3Store{
+		Bucket:       os.Getenv("S3_BUCKET"),
+		Region:       os.Getenv("AWS_REGION"),
+		Endpoint:     os.Getenv("S3_ENDPOINT"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET non impostato")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("credenziali AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY mancanti")
+	}
+	return s, nil
+}
+
+// Errore HTTP restituito da S3
+type s3Error struct {
+	Op     string
+	Key    string
+	Status int
+	Body   string
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("s3 %s %s: HTTP %d %s", e.Op, e.Key, e.Status, strings.TrimSpace(e.Body))
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	data, _, err := s.get(key)
+	return data, err
+}
+
+// Scarica l'oggetto restituendo anche l'ETag (usato dal compare-and-swap)
+func (s *S3Store) get(key string) ([]byte, string, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", ErrNotFound
+	}
+	return nil, "", &s3Error{"GET", key, resp.StatusCode, string(body)}
+}
+
+func (s *S3Store) Put(key string, data []byte) error {
+	_, err := s.put(key, data, nil)
+	return err
+}
+
+// Carica l'oggetto; restituisce false se una precondizione (If-Match/If-None-Match) non è soddisfatta
+func (s *S3Store) put(key string, data []byte, headers http.Header) (bool, error) {
+	resp, err := s.do(http.MethodPut, key, nil, headers, data)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return true, nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return false, nil
+	}
+	return false, &s3Error{"PUT", key, resp.StatusCode, string(body)}
+}
+
+func (s *S3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return &s3Error{"DELETE", key, resp.StatusCode, string(body)}
+}
+
+// Risposta di ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &s3Error{"LIST", prefix, resp.StatusCode, string(body)}
+		}
+
+		var result listBucketResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("s3 LIST %s: risposta non valida: %v", prefix, err)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Confronta il contenuto corrente con old e scrive new con una PUT condizionata sull'ETag letto,
+// così una scrittura concorrente tra lettura e scrittura fa fallire lo scambio
+func (s *S3Store) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	headers := http.Header{}
+	current, etag, err := s.get(key)
+	switch {
+	case err == ErrNotFound:
+		if old != nil {
+			return false, nil
+		}
+		headers.Set("If-None-Match", "*")
+	case err != nil:
+		return false, err
+	case old == nil || !bytes.Equal(current, old):
+		return false, nil
+	default:
+		headers.Set("If-Match", etag)
+	}
+	return s.put(key, new, headers)
+}
+
+// ========================================================================================
+// Richieste firmate
+// ========================================================================================
+
+// URL dell'oggetto (key vuota = bucket)
+func (s *S3Store) objectURL(key string) *url.URL {
+	path := "/" + strings.TrimPrefix(key, "/")
+	if s.Endpoint == "" {
+		return &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", s.Bucket, s.Region), Path: path}
+	}
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "http", Host: strings.TrimSuffix(s.Endpoint, "/")}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + path
+	return u
+}
+
+func (s *S3Store) do(method, key string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if body == nil {
+		req.ContentLength = 0
+		req.Body = http.NoBody
+	}
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	s.sign(req, body, now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return client.Do(req)
+}
+
+// Firma la richiesta con AWS Signature Version 4 (servizio s3)
+func (s *S3Store) sign(req *http.Request, body []byte, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	// Header firmati: host più tutti quelli impostati sulla richiesta
+	canonical := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "user-agent" {
+			continue
+		}
+		canonical[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(canonical))
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headerLines strings.Builder
+	for _, name := range names {
+		headerLines.WriteString(name + ":" + canonical[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		headerLines.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// Percorso URI-encoded segmento per segmento (S3 non normalizza il path)
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = uriEncode(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// Query string con chiavi ordinate e valori URI-encoded
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Codifica RFC 3986 richiesta da SigV4: solo A-Z a-z 0-9 - _ . ~ restano in chiaro
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
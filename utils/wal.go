@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* -------------------------------------------------------------
+		LOG DEGLI EVENTI DEI TASK (WAL)
+-------------------------------------------------------------- */
+
+// Ogni transizione di un task è un oggetto a sé in state/jobs/<id>/wal/ (append-only: nessun file riscritto).
+// Periodicamente la tabella dei task viene compattata in status.json del job e gli eventi già
+// inclusi vengono eliminati; al riavvio la tabella si ricostruisce da snapshot + eventi successivi.
+
+// Eventi tra due snapshot
+const walCompactEvery = 256
+
+// Stati di un task
+const (
+	TaskPending  = "pending"
+	TaskAssigned = "assigned"
+	TaskRunning  = "running"
+	TaskDone     = "done"
+	TaskFailed   = "failed"
+)
+
+// Tipi di task
+const (
+	MapTaskKind    = "map"
+	ReduceTaskKind = "reduce"
+)
+
+// TaskEvent è una transizione di stato di un task
+type TaskEvent struct {
+	Seq       int64                     `json:"seq"`
+	Kind      string                    `json:"kind"` // map | reduce
+	Task      string                    `json:"task"` // ID del chunk o Owner della partizione
+	State     string                    `json:"state"`
+	AttemptID string                    `json:"attemptId,omitempty"`
+	Worker    string                    `json:"worker,omitempty"`
+	Sent      map[string]int            `json:"sent,omitempty"`     // Record consegnati per Owner (map done)
+	Segments  map[string]ShuffleSegment `json:"segments,omitempty"` // Segmenti conservati dal mapper (shuffle pull)
+	Error     string                    `json:"error,omitempty"`
+	Time      time.Time                 `json:"time"`
+}
+
+// TaskStatus è lo stato corrente di un task nella tabella
+type TaskStatus struct {
+	State     string                    `json:"state"`
+	AttemptID string                    `json:"attemptId,omitempty"`
+	Worker    string                    `json:"worker,omitempty"`
+	Sent      map[string]int            `json:"sent,omitempty"`
+	Segments  map[string]ShuffleSegment `json:"segments,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// TaskTable è la tabella dei task ricostruita dal log; Seq è l'ultimo evento applicato
+type TaskTable struct {
+	Seq    int64                  `json:"seq"`
+	Map    map[string]*TaskStatus `json:"map"`
+	Reduce map[string]*TaskStatus `json:"reduce"`
+}
+
+func newTaskTable() TaskTable {
+	return TaskTable{Map: map[string]*TaskStatus{}, Reduce: map[string]*TaskStatus{}}
+}
+
+// Applica un evento: un task "done" resta tale (es. tentativo perdente che fallisce dopo);
+// un nuovo "done" dello stesso tentativo aggiorna solo i segmenti (chunk rieseguito per lo shuffle pull)
+func (t *TaskTable) apply(ev TaskEvent) {
+	tasks := t.Map
+	if ev.Kind == ReduceTaskKind {
+		tasks = t.Reduce
+	}
+	if ev.Seq > t.Seq {
+		t.Seq = ev.Seq
+	}
+
+	current := tasks[ev.Task]
+	if current != nil && current.State == TaskDone {
+		if ev.State == TaskDone && ev.AttemptID == current.AttemptID && len(ev.Segments) > 0 {
+			updated := *current
+			updated.Segments = make(map[string]ShuffleSegment, len(current.Segments)+len(ev.Segments))
+			for owner, seg := range current.Segments {
+				updated.Segments[owner] = seg
+			}
+			for owner, seg := range ev.Segments {
+				updated.Segments[owner] = seg
+			}
+			tasks[ev.Task] = &updated
+		}
+		return
+	}
+	next := &TaskStatus{State: ev.State, AttemptID: ev.AttemptID, Worker: ev.Worker, Sent: ev.Sent, Segments: ev.Segments, Error: ev.Error}
+	if current != nil && next.Worker == "" && next.AttemptID == current.AttemptID {
+		next.Worker = current.Worker
+	}
+	tasks[ev.Task] = next
+}
+
+// Copia profonda della tabella (per i lettori fuori dal lock)
+func (t TaskTable) clone() TaskTable {
+	out := TaskTable{Seq: t.Seq, Map: make(map[string]*TaskStatus, len(t.Map)), Reduce: make(map[string]*TaskStatus, len(t.Reduce))}
+	for id, s := range t.Map {
+		c := *s
+		out.Map[id] = &c
+	}
+	for id, s := range t.Reduce {
+		c := *s
+		out.Reduce[id] = &c
+	}
+	return out
+}
+
+// Chiave dell'evento: il numero a larghezza fissa mantiene l'ordine lessicografico
+func (s *JobState) walKey(seq int64) string {
+	return fmt.Sprintf("%s%016d.json", s.key(walName), seq)
+}
+
+func walSeq(key string) (int64, bool) {
+	seq, err := strconv.ParseInt(strings.TrimSuffix(path.Base(key), ".json"), 10, 64)
+	return seq, err == nil
+}
+
+// Elenca le chiavi degli eventi con il relativo numero di sequenza, in ordine
+func (s *JobState) listWAL() ([]string, []int64, error) {
+	keys, err := Store().List(s.key(walName))
+	if err != nil {
+		return nil, nil, err
+	}
+	var valid []string
+	var seqs []int64
+	for _, key := range keys {
+		if seq, ok := walSeq(key); ok {
+			valid = append(valid, key)
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Sort(walOrder{valid, seqs})
+	return valid, seqs, nil
+}
+
+type walOrder struct {
+	keys []string
+	seqs []int64
+}
+
+func (w walOrder) Len() int           { return len(w.keys) }
+func (w walOrder) Less(i, j int) bool { return w.seqs[i] < w.seqs[j] }
+func (w walOrder) Swap(i, j int) {
+	w.keys[i], w.keys[j] = w.keys[j], w.keys[i]
+	w.seqs[i], w.seqs[j] = w.seqs[j], w.seqs[i]
+}
+
+// Ricostruisce la tabella da snapshot + eventi successivi (con s.mu già acquisito)
+func (s *JobState) loadTaskLogLocked() error {
+	if s.loaded {
+		return nil
+	}
+
+	table := newTaskTable()
+	if err := readStateJSON(s.key(statusName), &table); err != nil && err != ErrNotFound {
+		return err
+	}
+	if table.Map == nil {
+		table.Map = map[string]*TaskStatus{}
+	}
+	if table.Reduce == nil {
+		table.Reduce = map[string]*TaskStatus{}
+	}
+
+	keys, seqs, err := s.listWAL()
+	if err != nil {
+		return err
+	}
+	replayed := 0
+	for i, key := range keys {
+		if seqs[i] <= table.Seq {
+			continue // Già incluso nello snapshot (compattazione interrotta)
+		}
+		var ev TaskEvent
+		if err := readStateJSON(key, &ev); err != nil {
+			return err
+		}
+		table.apply(ev)
+		replayed++
+	}
+	if replayed > 0 {
+		log.Printf("[STATE] Tabella dei task ricostruita: snapshot + %d eventi (seq %d)", replayed, table.Seq)
+	}
+
+	s.table = table
+	s.pending = replayed
+	s.loaded = true
+	return nil
+}
+
+// Aggiunge un evento al log e lo applica alla tabella; compatta ogni walCompactEvery eventi
+func (s *JobState) appendTaskEvent(ev TaskEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTaskLogLocked(); err != nil {
+		return err
+	}
+	ev.Seq = s.table.Seq + 1
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if err := writeStateJSON(s.walKey(ev.Seq), ev); err != nil {
+		return err
+	}
+	s.table.apply(ev)
+	s.pending++
+
+	if s.pending >= walCompactEvery {
+		if err := s.compactTaskLogLocked(); err != nil {
+			log.Printf("[STATE] Errore compattazione del log dei task: %v", err)
+		}
+	}
+	return nil
+}
+
+// Scrive lo snapshot della tabella e rimuove gli eventi già inclusi
+func (s *JobState) compactTaskLogLocked() error {
+	if err := writeStateJSON(s.key(statusName), s.table); err != nil {
+		return err
+	}
+	keys, seqs, err := s.listWAL()
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if seqs[i] <= s.table.Seq {
+			if err := Store().Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("[STATE] Log dei task compattato in %s (seq %d, %d eventi rimossi)", s.key(statusName), s.table.Seq, s.pending)
+	s.pending = 0
+	return nil
+}
+
+// Sostituisce la tabella con una nuova (snapshot) ed elimina tutti gli eventi precedenti
+func (s *JobState) resetTaskTableLocked(table TaskTable) error {
+	keys, _, err := s.listWAL()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := Store().Delete(key); err != nil {
+			return err
+		}
+	}
+	s.table = table
+	s.pending = 0
+	s.loaded = true
+	return writeStateJSON(s.key(statusName), table)
+}
+
+// Restituisce una copia della tabella dei task corrente
+func (s *JobState) LoadTaskTable() (TaskTable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadTaskLogLocked(); err != nil {
+		return TaskTable{}, err
+	}
+	return s.table.clone(), nil
+}
+
+// Registra una transizione di un task di Map (assigned, running, failed)
+func (s *JobState) RecordMapEvent(chunkID int, state, attemptID, worker string, cause error) {
+	ev := TaskEvent{Kind: MapTaskKind, Task: strconv.Itoa(chunkID), State: state, AttemptID: attemptID, Worker: worker}
+	if cause != nil {
+		ev.Error = cause.Error()
+	}
+	if err := s.appendTaskEvent(ev); err != nil {
+		log.Printf("[STATE] Errore registrazione evento chunk %d → %s: %v", chunkID, state, err)
+	}
+}
+
+// Registra il completamento di un chunk: tentativo accettato, record consegnati a ogni Owner e,
+// con lo shuffle pull, segmenti conservati dal mapper.
+// È l'evento che rende il chunk "done" al riavvio: se non viene scritto il chunk non è completato.
+func (s *JobState) RecordMapDone(chunkID int, attemptID, worker string, sent map[string]int, segments map[string]ShuffleSegment) error {
+	ev := TaskEvent{Kind: MapTaskKind, Task: strconv.Itoa(chunkID), State: TaskDone, AttemptID: attemptID, Worker: worker, Sent: sent, Segments: segments}
+	if err := s.appendTaskEvent(ev); err != nil {
+		return fmt.Errorf("registrazione completamento chunk %d: %v", chunkID, err)
+	}
+	log.Printf("[STATE] Stato aggiornato: chunk %d → done (tentativo %s)", chunkID, attemptID)
+	return nil
+}
+
+// Registra la nuova posizione dei segmenti di un chunk già completato, rieseguito per lo shuffle pull
+// perché il mapper che li conservava non è più raggiungibile
+func (s *JobState) RecordMapSegments(chunkID int, attemptID string, segments map[string]ShuffleSegment) error {
+	ev := TaskEvent{Kind: MapTaskKind, Task: strconv.Itoa(chunkID), State: TaskDone, AttemptID: attemptID, Segments: segments}
+	return s.appendTaskEvent(ev)
+}
@@ -3,113 +3,545 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sdcc-mapreduce/utils"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Worker gestisce i task di Map e Reduce
 type Worker struct{}
 
-// Esegue il task di Map: ordina il chunk di numeri ricevuto e lo invia ai reducer appropriati
+// Esegue il task di Map: applica la Map del job al chunk ricevuto e invia i record ai reducer appropriati
 func (Worker) MapTask(req utils.MapRequest, reply *utils.MapReply) error {
-	log.Printf("Mapper ha ricevuto il chunk: %v\n", req.Chunk)
+	log.Printf("Mapper ha ricevuto il chunk %d (tentativo %s): %d record (job %q, chiavi %q)\n", req.ChunkID, req.AttemptID, req.Chunk.Len(), req.JobType, req.KeyType)
 	time.Sleep(5 * time.Second)
 
-	// Ordina i numeri localmente
-	sort.Ints(req.Chunk)
-	log.Printf("Chunk ordinato: %v\n", req.Chunk)
+	job, err := utils.GetJob(req.JobType)
+	if err != nil {
+		log.Printf("Errore MapTask: %v\n", err)
+		return err
+	}
+	kt, err := utils.GetKeyType(req.KeyType)
+	if err != nil {
+		log.Printf("Errore MapTask: %v\n", err)
+		return err
+	}
 
-	// Scrive il chunk ordinato in un file temporaneo, stile reducer
-	host, err := os.Hostname()
+	// Partitioner descritto dal master: stessi confini per tutti i mapper e tutti i tentativi
+	partitioner, err := utils.NewPartitioner(req.Partition, kt)
 	if err != nil {
-		host = "unknown_mapper"
+		log.Printf("Errore MapTask: %v\n", err)
+		return err
 	}
-	tempFileName := fmt.Sprintf("output/temp_%s.txt", host)
+	owners := req.Partition.Reducers
 
-	file, err := os.OpenFile(tempFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Con Only il master ricostruisce solo alcune partizioni (reducer perso): le altre non si reinviano
+	wanted := make(map[string]bool)
+	for _, owner := range req.Only {
+		wanted[owner] = true
+	}
+
+	// Applica la Map del job a blocchi di record e ordina i record intermedi con l'ordinamento esterno:
+	// oltre SortBufferMB i record vengono scritti su disco in run ordinate, unite poi con un merge
+	sorter, err := utils.NewExternalSorter(filepath.Join(sortDir(), fmt.Sprintf("c%06d_%s_%d", req.ChunkID, req.AttemptID, time.Now().UnixNano())), kt, req.SortBufferMB, req.MergeFanIn)
 	if err != nil {
-		log.Printf("Errore apertura %s: %v", tempFileName, err)
-	} else {
-		writer := bufio.NewWriter(file)
-		for _, num := range req.Chunk {
-			writer.WriteString(fmt.Sprintf("%d\n", num))
-		}
-		writer.Flush()
-		file.Close()
-		log.Printf("Mapper ha scritto i risultati in: %s\n", tempFileName)
+		log.Printf("Errore MapTask: %v\n", err)
+		return err
 	}
+	defer sorter.Close()
 
+	batch := make([]utils.Record, 0, mapBatchSize)
+	mapBatch := func() error {
+		for _, r := range job.Map(batch) {
+			if err := sorter.Add(r); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = req.Chunk.Each(func(r utils.Record) error {
+		batch = append(batch, r)
+		if len(batch) == mapBatchSize {
+			return mapBatch()
+		}
+		return nil
+	})
+	if err == nil {
+		err = mapBatch()
+	}
+	if err != nil {
+		log.Printf("Errore Map del chunk %d: %v\n", req.ChunkID, err)
+		return err
+	}
 
-	// Mappa: reducer --> sotto-chunk assegnato
-	assignments := make(map[string][]int)
+	// I record ordinati vengono assegnati alle partizioni (le chiavi calde sono divise in modo
+	// deterministico) e scritti nel file di shuffle locale: ai reducer arriva solo il descrittore
+	// del proprio segmento e i record vengono letti direttamente da questo mapper
+	shufflePath := filepath.Join(shuffleDir(), shuffleFileName(req.JobID, req.ChunkID, req.AttemptID))
+	shuffleWriter, err := utils.NewShuffleWriter(shufflePath+".parts", owners)
+	if err != nil {
+		log.Printf("Errore MapTask: %v\n", err)
+		return err
+	}
+	defer shuffleWriter.Close()
 
-	// Tutti i reducer disponibili
-	var allReducers []string
-	for addr := range req.ReducerRanges {
-		allReducers = append(allReducers, addr)
+	// Combiner: ogni partizione viaggia con i valori già combinati (dopo il partizionamento,
+	// così le chiavi calde restano divise tra le loro partizioni)
+	combiners := make(map[string]*utils.CombineStream)
+	assigner := utils.NewAssigner(partitioner, req.ChunkID)
+	mapped, routed := 0, 0
+	passes, err := sorter.Sort(func(r utils.Record) error {
+		mapped++
+		owner := owners[assigner.Assign(r.Key)]
+		if len(wanted) > 0 && !wanted[owner] {
+			return nil
+		}
+		routed++
+		if !req.Combine {
+			return shuffleWriter.Write(owner, r)
+		}
+		stream := combiners[owner]
+		if stream == nil {
+			stream = utils.NewCombineStream(job, func(c utils.Record) error {
+				return shuffleWriter.Write(owner, c)
+			})
+			combiners[owner] = stream
+		}
+		return stream.Add(r)
+	})
+	for _, stream := range combiners {
+		if err == nil {
+			err = stream.Flush()
+		}
+	}
+	if err != nil {
+		log.Printf("Errore ordinamento del chunk %d: %v\n", req.ChunkID, err)
+		return err
 	}
+	log.Printf("Chunk mappato e ordinato: %d record, %d run su disco, %d passi di merge\n", mapped, sorter.Spills(), passes)
 
-	// Assegna ciascun numero al reducer corretto
-	for _, num := range req.Chunk {
-		assigned := false
-		for addr, bounds := range req.ReducerRanges {
-			if num >= bounds[0] && num < bounds[1] {
-				assignments[addr] = append(assignments[addr], num)
-				assigned = true
-				log.Printf("Numero %d --> %s (range %d-%d)", num, addr, bounds[0], bounds[1])
-				break
-			}
+	segments, err := shuffleWriter.Finish(shufflePath)
+	if err != nil {
+		log.Printf("Errore scrittura shuffle %s: %v\n", shufflePath, err)
+		return err
+	}
+	if req.Combine {
+		combined := 0
+		for _, seg := range segments {
+			combined += seg.Records
 		}
-		if !assigned {
-			log.Printf("Errore: numero %d non assegnato a nessun reducer!\n", num)
+		log.Printf("Combiner: %d record ridotti a %d\n", routed, combined)
+	}
+
+	reply.Sent = make(map[string]int)
+
+	// Shuffle pull: il mapper conserva il file e restituisce i descrittori al master,
+	// che li indicherà ai reducer in fase di Reduce
+	if req.Shuffle == utils.PullShuffle {
+		reply.Segments = make(map[string]utils.ShuffleSegment)
+		for owner, seg := range segments {
+			seg.Source = workerAddress
+			reply.Segments[owner] = seg
+			reply.Sent[owner] = seg.Records
 		}
+		log.Printf("Segmenti di %d partizioni conservati in %s\n", len(segments), shufflePath)
+		reply.Ack = true
+		return nil
 	}
+	// In modalità push il file serve solo durante le consegne
+	defer os.Remove(shufflePath)
 
-	// Invia ogni sotto-chunk al reducer assegnato, con fallback se fallisce
-	for primaryAddr, nums := range assignments {
-		log.Printf("Invio il sotto-chunk %v al reducer %s (con fallback)\n", nums, primaryAddr)
-		err := SendToReducerWithFallback(nums, primaryAddr, allReducers)
-		if err != nil {
-			log.Printf("Fallimento finale invio chunk %v: %v\n", nums, err)
+	// Invia ogni descrittore al reducer che ospita la partizione. Se il reducer non risponde
+	// la partizione viene segnalata al master, che la riassegna e la ricostruisce altrove.
+	for owner, seg := range segments {
+		seg.Source = workerAddress
+		reply.Sent[owner] = seg.Records
+		target := req.Partition.Target(owner)
+		log.Printf("Invio del segmento della partizione %s (%d record, %d byte) al reducer %s\n", owner, seg.Records, seg.Length, target)
+		base := utils.ReduceRequest{
+			JobID:     req.JobID,
+			Segment:   seg,
+			Owner:     owner,
+			JobType:   req.JobType,
+			KeyType:   req.KeyType,
+			ChunkID:   req.ChunkID,
+			AttemptID: req.AttemptID,
+		}
+		if err := SendToReducerWithRetry(base, target); err != nil {
+			log.Printf("Consegna della partizione %s a %s fallita: %v\n", owner, target, err)
+			reply.Undelivered = append(reply.Undelivered, owner)
 		}
 	}
+	sort.Strings(reply.Undelivered)
 
 	// ACK al master
 	reply.Ack = true
 	return nil
 }
 
-// Esegue task di Reduce
+// Esegue task di Reduce: legge dal mapper il segmento descritto nella richiesta e lo salva come run
+// ordinata separata. Il merge delle run avviene in FinalizeReduce, a fase di Map conclusa.
+// La consegna è idempotente: la run di una coppia (chunk, partizione) per un dato tentativo
+// ha un nome deterministico e una consegna ripetuta (es. retry dopo una risposta persa) viene ignorata.
 func (Worker) ReduceTask(req utils.ReduceRequest, reply *utils.ReduceReply) error {
-  log.Printf("\nReducer ha ricevuto i seguenti chunk: %v per Owner %s\n", req.Chunks, req.Owner)
+  log.Printf("\nReducer ha ricevuto il segmento di %d record per Owner %s da %s (job %s, chunk %d, tentativo %s, tipo %q)\n", req.Segment.Records, req.Owner, req.Segment.Source, req.JobID, req.ChunkID, req.AttemptID, req.JobType)
+
+  if req.AttemptID == "" {
+    return fmt.Errorf("consegna senza AttemptID per il chunk %d", req.ChunkID)
+  }
+  runPath := filepath.Join(runsDir(req.JobID, req.Owner), runFileName(req.ChunkID, req.AttemptID))
+
+  // Deduplicazione: la run esiste già (consegna ripetuta o ricostruzione della partizione)
+  if runDelivered(runPath) {
+    log.Printf("Consegna duplicata ignorata: chunk %d, tentativo %s, Owner %s\n", req.ChunkID, req.AttemptID, req.Owner)
+    reply.Ack = true
+    reply.Duplicate = true
+    return nil
+  }
 
-  // Usa Owner per formare il nome del file
-  ownerSafe := strings.ReplaceAll(req.Owner, ":", "_")
-  tempFileName := fmt.Sprintf("output/temp_%s.txt", ownerSafe)
+  // Il segmento è già ordinato dal mapper e ha il formato delle run: viene salvato così com'è
+  // dopo la verifica del checksum (il merge controlla comunque l'ordine). Il download avviene
+  // senza lock, in un file temporaneo: un mapper lento non blocca le altre consegne.
+  pullPath := fmt.Sprintf("%s.pull-%d", runPath, time.Now().UnixNano())
+  if err := utils.PullSegment(req.Segment, pullPath); err != nil {
+    log.Printf("Errore lettura del segmento per la run %s: %v\n", runPath, err)
+    return err
+  }
+
+  deliveriesMu.Lock()
+  defer deliveriesMu.Unlock()
+  defer os.Remove(pullPath)
+
+  // Una consegna concorrente dello stesso segmento può essere arrivata prima
+  if _, err := os.Stat(runPath); err == nil {
+    log.Printf("Consegna duplicata ignorata: chunk %d, tentativo %s, Owner %s\n", req.ChunkID, req.AttemptID, req.Owner)
+    reply.Ack = true
+    reply.Duplicate = true
+    return nil
+  }
+  // Fallisce se nel frattempo ReleaseJob ha rimosso i file del job
+  if err := os.Rename(pullPath, runPath); err != nil {
+    log.Printf("Errore salvataggio della run %s: %v\n", runPath, err)
+    return err
+  }
+
+  log.Printf("Reducer ha salvato la run: %s\n", runPath)
+
+  // Invio ACK al master
+  reply.Ack = true
+  return nil
+}
+
+// Serializza il controllo "già applicata" e il salvataggio delle run con la rimozione dei file
+// dei job (ReleaseJob); non viene tenuto durante il download dei segmenti
+var deliveriesMu sync.Mutex
+
+// Indica se la run è già stata salvata
+func runDelivered(runPath string) bool {
+  deliveriesMu.Lock()
+  defer deliveriesMu.Unlock()
+  _, err := os.Stat(runPath)
+  return err == nil
+}
+
+// Cartella locale del worker per run e partizioni (DATA_DIR, default output): non è condivisa
+// con gli altri worker, il master recupera le partizioni chiuse con FetchOutput
+var dataDir = "output"
+
+// Indirizzo di questo worker, indicato nei segmenti di shuffle come sorgente dei dati
+var workerAddress string
+
+// Cartella dei file di shuffle scritti dal mapper
+func shuffleDir() string {
+  return filepath.Join(dataDir, "shuffle")
+}
+
+// Cartella delle run temporanee dell'ordinamento esterno in Map
+func sortDir() string {
+  return filepath.Join(dataDir, "sort")
+}
+
+// Cartella dei file di un job (run, partizioni chiuse, merge): job diversi non condividono file.
+// Le richieste senza JobID usano direttamente la cartella del worker.
+func jobDir(jobID string) string {
+  if jobID == "" {
+    return dataDir
+  }
+  return filepath.Join(dataDir, "jobs", jobID)
+}
+
+// Cartella delle run intermedie del merge a più passi in FinalizeReduce
+func mergeDir(jobID string) string {
+  return filepath.Join(jobDir(jobID), "merge")
+}
+
+// Record passati a ogni chiamata della Map del job
+const mapBatchSize = 10000
+
+// Nome del file di shuffle di un tentativo: univoco anche tra esecuzioni ripetute dello stesso
+// tentativo, che possono consegnare solo alcune partizioni. Il prefisso del job permette di
+// eliminare i file del job concluso.
+func shuffleFileName(jobID string, chunkID int, attemptID string) string {
+  return fmt.Sprintf("%s_c%06d_%s_%d.shuffle", jobID, chunkID, attemptID, time.Now().UnixNano())
+}
+
+// Cartella che contiene le run ricevute per un Owner
+func runsDir(jobID, owner string) string {
+  return filepath.Join(jobDir(jobID), "runs", utils.SanitizeAddr(owner))
+}
+
+// File della partizione chiusa di un Owner
+func partitionFile(jobID, owner string) string {
+  return filepath.Join(jobDir(jobID), fmt.Sprintf("temp_%s.txt", utils.SanitizeAddr(owner)))
+}
 
-  // Scrive nel file temporaneo
-  file, err := os.OpenFile(tempFileName,
-    os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Nome deterministico della run di un chunk per un tentativo
+func runFileName(chunkID int, attemptID string) string {
+  return fmt.Sprintf("run_c%06d_%s.jsonl", chunkID, attemptID)
+}
+
+// Estrae chunk e tentativo dal nome di una run
+func parseRunName(name string) (chunkID int, attemptID string, ok bool) {
+  var rest string
+  if _, err := fmt.Sscanf(name, "run_c%d_%s", &chunkID, &rest); err != nil {
+    return 0, "", false
+  }
+  attemptID = strings.TrimSuffix(rest, ".jsonl")
+  return chunkID, attemptID, attemptID != rest
+}
+
+// Indica se una run appartiene al tentativo accettato del suo chunk (senza elenco si accetta tutto)
+func runAccepted(name string, accepted map[int]string) bool {
+  if accepted == nil {
+    return true
+  }
+  chunkID, attemptID, ok := parseRunName(name)
+  if !ok {
+    return false
+  }
+  return accepted[chunkID] == attemptID
+}
+
+// Chiude la partizione di un Owner: merge k-way delle run, Reduce per chiave e scrittura del file ordinato
+func (Worker) FinalizeReduce(req utils.FinalizeRequest, reply *utils.FinalizeReply) error {
+  log.Printf("Finalizzazione partizione di %s (job %s, tipo %q)\n", req.Owner, req.JobID, req.JobType)
+
+  job, err := utils.GetJob(req.JobType)
   if err != nil {
-    log.Fatalf("Errore apertura %s: %v", tempFileName, err)
+    log.Printf("Errore FinalizeReduce: %v\n", err)
+    return err
   }
-  defer file.Close()
+  kt, err := utils.GetKeyType(req.KeyType)
+  if err != nil {
+    log.Printf("Errore FinalizeReduce: %v\n", err)
+    return err
+  }
+
+  allRuns, err := filepath.Glob(filepath.Join(runsDir(req.JobID, req.Owner), "run_*.jsonl"))
+  if err != nil {
+    return err
+  }
+  sort.Strings(allRuns)
 
-  // Scrive ogni numero ricevuto in una nuova riga del file
+  // Scarta le run dei tentativi non accettati (es. perdenti dell'esecuzione speculativa)
+  var runs []string
+  for _, path := range allRuns {
+    if !runAccepted(filepath.Base(path), req.Accepted) {
+      log.Printf("Run %s scartata: tentativo non accettato\n", path)
+      continue
+    }
+    runs = append(runs, path)
+  }
+
+  // Scrive su file temporaneo e rinomina solo a merge concluso
+  tempFileName := partitionFile(req.JobID, req.Owner)
+  file, err := os.Create(tempFileName + ".tmp")
+  if err != nil {
+    return err
+  }
   writer := bufio.NewWriter(file)
-  for _, num := range req.Chunks {
-    writer.WriteString(fmt.Sprintf("%d\n", num))
+
+  // Raggruppa i record consecutivi con la stessa chiave e applica la Reduce
+  var (
+    inputRecords  int
+    inputValues   int
+    outputRecords int
+    currentKey    string
+    values        [][]byte
+  )
+  flush := func() {
+    if values == nil {
+      return
+    }
+    for _, r := range job.Reduce(currentKey, values) {
+      writer.WriteString(utils.FormatRecord(r) + "\n")
+      outputRecords++
+    }
+    values = nil
+  }
+
+  // Merge a più passi: con più di MergeFanIn run i risultati intermedi vanno su disco
+  mergeTmp := filepath.Join(mergeDir(req.JobID), utils.SanitizeAddr(req.Owner))
+  defer os.RemoveAll(mergeTmp)
+  passes, err := utils.MergeRunsMultiPass(runs, kt, req.MergeFanIn, mergeTmp, func(r utils.Record) error {
+    inputRecords++
+    if values != nil && r.Key != currentKey {
+      flush()
+    }
+    currentKey = r.Key
+    // I record combinati in Map vengono espansi: la Reduce riceve un valore per occorrenza
+    values = utils.AppendValues(values, r)
+    inputValues += r.Occurrences()
+    return nil
+  })
+  if err == nil {
+    flush()
+    err = writer.Flush()
+  }
+  file.Close()
+  if err != nil {
+    os.Remove(tempFileName + ".tmp")
+    log.Printf("Errore merge partizione %s: %v\n", req.Owner, err)
+    return err
+  }
+  if err := os.Rename(tempFileName+".tmp", tempFileName); err != nil {
+    return err
   }
-  writer.Flush()
 
-  log.Printf("Reducer ha scritto i risultati in: %s\n", tempFileName)
+  log.Printf("Partizione %s completata: %d run in %d passi di merge, %d record in ingresso (%d valori), %d in uscita → %s\n",
+    req.Owner, len(runs), passes, inputRecords, inputValues, outputRecords, tempFileName)
 
-  // Invio ACK al master
   reply.Ack = true
+  reply.Runs = len(runs)
+  reply.MergePasses = passes
+  reply.InputRecords = inputRecords
+  reply.InputValues = inputValues
+  reply.OutputRecords = outputRecords
+  return nil
+}
+
+// Restituisce un blocco di un segmento di shuffle conservato da questo mapper
+func (Worker) FetchPartition(req utils.FetchPartitionRequest, reply *utils.FetchPartitionReply) error {
+  seg := req.Segment
+  // Solo file della cartella di shuffle, qualunque sia il percorso richiesto
+  file, err := os.Open(filepath.Join(shuffleDir(), filepath.Base(seg.Path)))
+  if err != nil {
+    return fmt.Errorf("file di shuffle %s non disponibile: %v", seg.Path, err)
+  }
+  defer file.Close()
+
+  size := seg.Length - req.Offset
+  if size > utils.ShuffleBlockSize {
+    size = utils.ShuffleBlockSize
+  }
+  if req.Offset < 0 || size <= 0 {
+    return fmt.Errorf("offset %d fuori dal segmento di %d byte", req.Offset, seg.Length)
+  }
+  buf := make([]byte, size)
+  n, err := file.ReadAt(buf, seg.Offset+req.Offset)
+  if err != nil && err != io.EOF {
+    return err
+  }
+  reply.Data = buf[:n]
+  return nil
+}
+
+// Numero di segmenti scaricati in parallelo da PullPartition
+const pullParallelism = 4
+
+// Shuffle pull: scarica dai mapper i segmenti della partizione indicati dal master e li salva come run.
+// I segmenti già presenti come run vengono saltati, quindi un reducer riavviato scarica solo quelli persi;
+// i chunk il cui mapper non fornisce il segmento vengono restituiti in Missing.
+func (Worker) PullPartition(req utils.PullPartitionRequest, reply *utils.PullPartitionReply) error {
+  log.Printf("Download di %d segmenti per Owner %s\n", len(req.Sources), req.Owner)
+
+  var (
+    mu  sync.Mutex
+    wg  sync.WaitGroup
+    sem = make(chan struct{}, pullParallelism)
+  )
+  for _, src := range req.Sources {
+    runPath := filepath.Join(runsDir(req.JobID, req.Owner), runFileName(src.ChunkID, src.AttemptID))
+    if _, err := os.Stat(runPath); err == nil {
+      reply.Skipped++
+      continue
+    }
+
+    wg.Add(1)
+    sem <- struct{}{}
+    go func(src utils.ShuffleSource, runPath string) {
+      defer wg.Done()
+      defer func() { <-sem }()
+
+      err := utils.PullSegment(src.Segment, runPath)
+      mu.Lock()
+      defer mu.Unlock()
+      if err != nil {
+        log.Printf("Segmento del chunk %d per Owner %s non scaricato: %v\n", src.ChunkID, req.Owner, err)
+        reply.Missing = append(reply.Missing, src.ChunkID)
+        return
+      }
+      reply.Fetched++
+    }(src, runPath)
+  }
+  wg.Wait()
+  sort.Ints(reply.Missing)
+
+  log.Printf("Owner %s: %d segmenti scaricati, %d già presenti, %d mancanti\n", req.Owner, reply.Fetched, reply.Skipped, len(reply.Missing))
+  return nil
+}
+
+// Dimensione massima di un blocco restituito da FetchOutput
+const fetchBlockSize = 1 << 20
+
+// Restituisce un blocco del file di una partizione chiusa con FinalizeReduce
+func (Worker) FetchOutput(req utils.FetchRequest, reply *utils.FetchReply) error {
+  file, err := os.Open(partitionFile(req.JobID, req.Owner))
+  if err != nil {
+    return fmt.Errorf("partizione %s non disponibile: %v", req.Owner, err)
+  }
+  defer file.Close()
+
+  buf := make([]byte, fetchBlockSize)
+  n, err := file.ReadAt(buf, req.Offset)
+  if err != nil && err != io.EOF {
+    return err
+  }
+  reply.Data = buf[:n]
+  reply.EOF = err == io.EOF
   return nil
 }
 
+// Elimina i file di un job concluso: run e partizioni chiuse (reducer), file di shuffle (mapper)
+func (Worker) ReleaseJob(req utils.ReleaseJobRequest, reply *utils.ReleaseJobReply) error {
+  if req.JobID == "" {
+    return fmt.Errorf("ReleaseJob senza JobID")
+  }
+
+  deliveriesMu.Lock()
+  defer deliveriesMu.Unlock()
+
+  paths, err := filepath.Glob(filepath.Join(shuffleDir(), req.JobID+"_*.shuffle"))
+  if err != nil {
+    return err
+  }
+  if _, err := os.Stat(jobDir(req.JobID)); err == nil {
+    paths = append(paths, jobDir(req.JobID))
+  }
+  for _, path := range paths {
+    if err := os.RemoveAll(path); err != nil {
+      log.Printf("Errore rimozione di %s: %v\n", path, err)
+      continue
+    }
+    reply.Removed++
+  }
+  log.Printf("Job %s rilasciato: %d file e cartelle rimossi\n", req.JobID, reply.Removed)
+  return nil
+}
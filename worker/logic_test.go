@@ -0,0 +1,460 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sdcc-mapreduce/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyListener accetta connessioni che perdono la prima risposta RPC:
+// la richiesta viene eseguita ma la connessione si chiude prima della risposta
+type lossyListener struct {
+	net.Listener
+	mu    sync.Mutex
+	drops int // Risposte ancora da perdere
+}
+
+func (l *lossyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &lossyConn{Conn: conn, listener: l}, nil
+}
+
+type lossyConn struct {
+	net.Conn
+	listener *lossyListener
+}
+
+func (c *lossyConn) Write(p []byte) (int, error) {
+	c.listener.mu.Lock()
+	drop := c.listener.drops > 0
+	if drop {
+		c.listener.drops--
+	}
+	c.listener.mu.Unlock()
+
+	if drop {
+		c.Conn.Close()
+		return 0, errors.New("risposta persa (iniettato)")
+	}
+	return c.Conn.Write(p)
+}
+
+// Avvia un worker RPC in-process (mapper o reducer) e ne restituisce l'indirizzo
+func startWorker(t *testing.T, drops int) string {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &lossyListener{Listener: inner, drops: drops}
+	t.Cleanup(func() { listener.Close() })
+
+	server := rpc.NewServer()
+	if err := server.Register(new(Worker)); err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(listener)
+	return inner.Addr().String()
+}
+
+// Avvia un server che accetta connessioni senza mai rispondere (worker o master bloccato)
+func startHungServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// Esegue il test in una cartella temporanea (i worker scrivono in output/ relativo)
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// Scrive, come MapTask, un file di shuffle con i record del chunk e restituisce la consegna
+// per il reducer: i record vengono letti dal worker source
+func shuffleRequest(t *testing.T, source, owner string, nums []int, chunkID int, attemptID string) utils.ReduceRequest {
+	t.Helper()
+	path := filepath.Join(shuffleDir(), shuffleFileName("", chunkID, attemptID))
+	parts := map[string][]utils.Record{owner: utils.IntsToRecords(nums)}
+	segments, err := utils.WriteShuffleFile(path, []string{owner}, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg := segments[owner]
+	seg.Source = source
+	return utils.ReduceRequest{Segment: seg, Owner: owner, JobType: "sort", ChunkID: chunkID, AttemptID: attemptID}
+}
+
+// Chiude la partizione dell'Owner e restituisce le righe del file risultante
+func finalize(t *testing.T, owner string, accepted map[int]string) []string {
+	t.Helper()
+	var reply utils.FinalizeReply
+	err := Worker{}.FinalizeReduce(utils.FinalizeRequest{Owner: owner, JobType: "sort", Accepted: accepted}, &reply)
+	if err != nil {
+		t.Fatalf("FinalizeReduce: %v", err)
+	}
+	content, err := os.ReadFile("output/temp_" + utils.SanitizeAddr(owner) + ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestReduceTaskDeduplicatesRepeatedDelivery(t *testing.T) {
+	chdirTemp(t)
+
+	req := shuffleRequest(t, startWorker(t, 0), "reducer:9001", []int{1, 2, 3}, 4, "a1-1")
+	for i := 0; i < 3; i++ {
+		var reply utils.ReduceReply
+		if err := (Worker{}).ReduceTask(req, &reply); err != nil {
+			t.Fatalf("consegna %d: %v", i, err)
+		}
+		if !reply.Ack || reply.Duplicate != (i > 0) {
+			t.Fatalf("consegna %d: reply %+v", i, reply)
+		}
+	}
+
+	lines := finalize(t, req.Owner, map[int]string{4: "a1-1"})
+	want := []string{"1", "2", "3"}
+	if len(lines) != len(want) {
+		t.Fatalf("righe = %v, attese %v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("righe = %v, attese %v", lines, want)
+		}
+	}
+}
+
+// Un mapper che non risponde non blocca le altre consegne né il rilascio dei job: la sua consegna
+// fallisce allo scadere del timeout senza lasciare run parziali
+func TestReduceTaskHungMapperDoesNotBlockDeliveries(t *testing.T) {
+	chdirTemp(t)
+	defer func(timeout time.Duration) { utils.SegmentCallTimeout = timeout }(utils.SegmentCallTimeout)
+	utils.SegmentCallTimeout = 500 * time.Millisecond
+
+	owner := "reducer:9001"
+	hung := shuffleRequest(t, startHungServer(t), owner, []int{9}, 1, "a1-1")
+	done := make(chan error, 1)
+	go func() { done <- (Worker{}).ReduceTask(hung, &utils.ReduceReply{}) }()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	var reply utils.ReduceReply
+	if err := (Worker{}).ReduceTask(shuffleRequest(t, startWorker(t, 0), owner, []int{1, 2}, 2, "a1-1"), &reply); err != nil || !reply.Ack {
+		t.Fatalf("consegna dal mapper attivo: %v, %+v", err, reply)
+	}
+	if err := (Worker{}).ReleaseJob(utils.ReleaseJobRequest{JobID: "altro"}, &utils.ReleaseJobReply{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("consegna e rilascio attesi per %v dietro al mapper bloccato", elapsed)
+	}
+
+	if err := <-done; err == nil {
+		t.Fatal("consegna dal mapper bloccato riuscita")
+	}
+	files, _ := filepath.Glob(filepath.Join(runsDir("", owner), "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != runFileName(2, "a1-1") {
+		t.Errorf("file nella cartella delle run: %v", files)
+	}
+}
+
+func TestSendToReducerWithRetryNoDuplicatesOnReplyLoss(t *testing.T) {
+	chdirTemp(t)
+
+	// Il reducer applica la consegna ma perde la risposta; il mapper ripete l'invio allo stesso reducer
+	primary := startWorker(t, 1)
+
+	var nums []int
+	for i := 0; i < 50; i++ {
+		nums = append(nums, i)
+	}
+	base := shuffleRequest(t, startWorker(t, 0), primary, nums, 0, "a1-1")
+	if err := SendToReducerWithRetry(base, primary); err != nil {
+		t.Fatalf("SendToReducerWithRetry: %v", err)
+	}
+
+	// Il master ripete lo stesso tentativo (es. MapReply persa o ricostruzione della partizione):
+	// anche questa consegna va ignorata
+	if err := SendToReducerWithRetry(base, primary); err != nil {
+		t.Fatalf("seconda consegna: %v", err)
+	}
+
+	lines := finalize(t, primary, map[int]string{0: "a1-1"})
+	if len(lines) != len(nums) {
+		t.Fatalf("%d righe nell'output, attese %d (duplicati o perdite)", len(lines), len(nums))
+	}
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if seen[line] {
+			t.Fatalf("valore duplicato nell'output: %s", line)
+		}
+		seen[line] = true
+	}
+	for _, n := range nums {
+		if !seen[strconv.Itoa(n)] {
+			t.Fatalf("valore %d mancante", n)
+		}
+	}
+}
+
+func TestFinalizeReduceDiscardsRejectedAttempts(t *testing.T) {
+	chdirTemp(t)
+
+	owner := "reducer:9001"
+	mapper := startWorker(t, 0)
+	for _, attempt := range []string{"a1-1", "a1-2"} {
+		req := shuffleRequest(t, mapper, owner, []int{7, 8}, 2, attempt)
+		var reply utils.ReduceReply
+		if err := (Worker{}).ReduceTask(req, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := finalize(t, owner, map[int]string{2: "a1-2"})
+	if len(lines) != 2 {
+		t.Fatalf("righe = %v: le run del tentativo perdente devono essere scartate", lines)
+	}
+}
+
+func TestFetchOutputReturnsFinalizedPartition(t *testing.T) {
+	chdirTemp(t)
+
+	owner := "reducer:9001"
+	req := shuffleRequest(t, startWorker(t, 0), owner, []int{4, 9}, 0, "a1-1")
+	var reduceReply utils.ReduceReply
+	if err := (Worker{}).ReduceTask(req, &reduceReply); err != nil {
+		t.Fatal(err)
+	}
+	finalize(t, owner, map[int]string{0: "a1-1"})
+
+	var reply utils.FetchReply
+	if err := (Worker{}).FetchOutput(utils.FetchRequest{Owner: owner}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Data) != "4\n9\n" || !reply.EOF {
+		t.Fatalf("FetchOutput = %q (EOF %v)", reply.Data, reply.EOF)
+	}
+
+	// Una partizione mai chiusa su questo reducer (es. riassegnata altrove) è un errore
+	if err := (Worker{}).FetchOutput(utils.FetchRequest{Owner: "altro:9001"}, &reply); err == nil {
+		t.Fatal("partizione inesistente restituita")
+	}
+}
+
+func TestReduceTaskRejectsCorruptSegment(t *testing.T) {
+	chdirTemp(t)
+
+	owner := "reducer:9001"
+	req := shuffleRequest(t, startWorker(t, 0), owner, []int{1, 2, 3}, 1, "a1-1")
+	good := req.Segment
+
+	// Checksum o lunghezza non corrispondenti: la consegna fallisce e non lascia una run
+	// che bloccherebbe, come duplicata, la consegna corretta
+	for _, seg := range []utils.ShuffleSegment{
+		{Source: good.Source, Path: good.Path, Offset: good.Offset, Length: good.Length, Checksum: strings.Repeat("0", 64)},
+		{Source: good.Source, Path: good.Path, Offset: good.Offset, Length: good.Length + 10, Checksum: good.Checksum},
+	} {
+		req.Segment = seg
+		var reply utils.ReduceReply
+		if err := (Worker{}).ReduceTask(req, &reply); err == nil {
+			t.Fatalf("segmento non valido accettato: %+v", seg)
+		}
+	}
+
+	req.Segment = good
+	var reply utils.ReduceReply
+	if err := (Worker{}).ReduceTask(req, &reply); err != nil || reply.Duplicate {
+		t.Fatalf("consegna corretta: %v (reply %+v)", err, reply)
+	}
+	if lines := finalize(t, owner, map[int]string{1: "a1-1"}); len(lines) != 3 {
+		t.Fatalf("righe = %v", lines)
+	}
+}
+
+func TestPullPartitionFetchesOnlyMissingSegments(t *testing.T) {
+	chdirTemp(t)
+
+	owner := "reducer:9001"
+	mapper := startWorker(t, 0)
+	var sources []utils.ShuffleSource
+	for chunk, nums := range [][]int{{1, 5}, {2, 6}, {3}} {
+		req := shuffleRequest(t, mapper, owner, nums, chunk, "a1-1")
+		sources = append(sources, utils.ShuffleSource{ChunkID: chunk, AttemptID: req.AttemptID, Segment: req.Segment})
+	}
+	// Il mapper del chunk 2 non è più raggiungibile
+	sources[2].Segment.Source = "127.0.0.1:1"
+
+	var reply utils.PullPartitionReply
+	if err := (Worker{}).PullPartition(utils.PullPartitionRequest{Owner: owner, Sources: sources}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Fetched != 2 || reply.Skipped != 0 || len(reply.Missing) != 1 || reply.Missing[0] != 2 {
+		t.Fatalf("primo download: %+v", reply)
+	}
+
+	// Secondo download (es. dopo la riesecuzione del chunk 2): solo il segmento mancante
+	sources[2].Segment.Source = mapper
+	reply = utils.PullPartitionReply{}
+	if err := (Worker{}).PullPartition(utils.PullPartitionRequest{Owner: owner, Sources: sources}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Fetched != 1 || reply.Skipped != 2 || len(reply.Missing) != 0 {
+		t.Fatalf("secondo download: %+v", reply)
+	}
+
+	lines := finalize(t, owner, map[int]string{0: "a1-1", 1: "a1-1", 2: "a1-1"})
+	if strings.Join(lines, ",") != "1,2,3,5,6" {
+		t.Fatalf("righe = %v", lines)
+	}
+}
+
+// Job diversi con gli stessi Owner, chunk e tentativi non condividono run né partizioni;
+// ReleaseJob elimina solo i file del job indicato
+func TestJobsDoNotShareFiles(t *testing.T) {
+	chdirTemp(t)
+
+	owner := "reducer:9001"
+	source := startWorker(t, 0)
+	for job, nums := range map[string][]int{"job-a": {1, 2}, "job-b": {7}} {
+		req := shuffleRequest(t, source, owner, nums, 0, "a1-1")
+		req.JobID = job
+		var reply utils.ReduceReply
+		if err := (Worker{}).ReduceTask(req, &reply); err != nil || reply.Duplicate {
+			t.Fatalf("%s: consegna %v (reply %+v)", job, err, reply)
+		}
+		var finalized utils.FinalizeReply
+		err := Worker{}.FinalizeReduce(utils.FinalizeRequest{JobID: job, Owner: owner, JobType: "sort", Accepted: map[int]string{0: "a1-1"}}, &finalized)
+		if err != nil || finalized.InputRecords != len(nums) {
+			t.Fatalf("%s: FinalizeReduce %v, %d record", job, err, finalized.InputRecords)
+		}
+	}
+
+	var released utils.ReleaseJobReply
+	if err := (Worker{}).ReleaseJob(utils.ReleaseJobRequest{JobID: "job-a"}, &released); err != nil || released.Removed == 0 {
+		t.Fatalf("ReleaseJob = %v (%+v)", err, released)
+	}
+	var reply utils.FetchReply
+	if err := (Worker{}).FetchOutput(utils.FetchRequest{JobID: "job-a", Owner: owner}, &reply); err == nil {
+		t.Fatal("partizione del job rilasciato ancora disponibile")
+	}
+	if err := (Worker{}).FetchOutput(utils.FetchRequest{JobID: "job-b", Owner: owner}, &reply); err != nil || string(reply.Data) != "7\n" {
+		t.Fatalf("FetchOutput job-b = %q, %v", reply.Data, err)
+	}
+}
+
+// fakeMaster registra i worker che si presentano
+type fakeMaster struct {
+	registered chan string
+}
+
+func (m *fakeMaster) Register(req utils.WorkerConfig, reply *bool) error {
+	m.registered <- req.Address
+	*reply = true
+	return nil
+}
+
+// Un master che accetta connessioni senza mai rispondere non blocca la registrazione:
+// dopo il timeout il worker passa al master successivo
+func TestRegisterFailsOverFromUnresponsiveMaster(t *testing.T) {
+	defer func(timeout time.Duration) { masterTimeout = timeout }(masterTimeout)
+	masterTimeout = 200 * time.Millisecond
+
+	hung := startHungServer(t)
+
+	master := &fakeMaster{registered: make(chan string, 1)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Master", master); err != nil {
+		t.Fatal(err)
+	}
+	alive, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alive.Close()
+	go server.Accept(alive)
+
+	masters := newMasterList(hung + ", " + alive.Addr().String())
+	registerSelf("localhost:9101", "mapper", masters)
+
+	if got := <-master.registered; got != "localhost:9101" {
+		t.Fatalf("registrato %q", got)
+	}
+	if masters.current() != alive.Addr().String() {
+		t.Errorf("master corrente %s, atteso %s", masters.current(), alive.Addr())
+	}
+	if newMasterList(" , ") != nil {
+		t.Error("MASTER_ADDR senza indirizzi accettato")
+	}
+}
+
+// Tutti i file scritti da MapTask appartengono al job: dopo ReleaseJob nella cartella dei dati non resta nulla
+func TestReleaseJobRemovesMapFiles(t *testing.T) {
+	chdirTemp(t)
+
+	req := utils.MapRequest{
+		JobID:     "job-map",
+		Chunk:     utils.RecordChunks([][]utils.Record{utils.IntsToRecords([]int{5, 1, 9})})[0],
+		Partition: utils.PartitionSpec{Strategy: "hash", Reducers: []string{"reducer:9001"}},
+		JobType:   "sort",
+		AttemptID: "a1-1",
+		Shuffle:   utils.PullShuffle,
+	}
+	var reply utils.MapReply
+	if err := (Worker{}).MapTask(req, &reply); err != nil || reply.Sent["reducer:9001"] != 3 {
+		t.Fatalf("MapTask = %v (%+v)", err, reply)
+	}
+
+	var released utils.ReleaseJobReply
+	if err := (Worker{}).ReleaseJob(utils.ReleaseJobRequest{JobID: req.JobID}, &released); err != nil {
+		t.Fatal(err)
+	}
+	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("file %s rimasto dopo ReleaseJob", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"sdcc-mapreduce/utils"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,10 +28,10 @@ func main() {
 	address := flag.String("address", "localhost:9001", "Indirizzo e porta del worker (es. localhost:9001)")
 	flag.Parse()
 
-	// Legge variabili d’ambiente
+	// Legge variabili d’ambiente (MASTER_ADDR: master e standby separati da virgola)
 	role := os.Getenv("ROLE")
-	masterAddr := os.Getenv("MASTER_ADDR")
-	if role == "" || masterAddr == "" {
+	masters := newMasterList(os.Getenv("MASTER_ADDR"))
+	if role == "" || masters == nil {
 		log.Fatalf("Variabili ROLE o MASTER_ADDR mancanti")
 	}
 
@@ -43,8 +46,35 @@ func main() {
 	log.SetFlags(logger.Flags())      
 	log.SetPrefix(logger.Prefix())
 
+	// Cartella locale per run e partizioni: un reducer che riparte non ha più le partizioni
+	// precedenti, il master le ricostruisce rieseguendo i mapper
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		dataDir = dir
+	}
+	workerAddress = *address
+	if role == "reducer" {
+		for _, dir := range []string{filepath.Join(dataDir, "runs"), filepath.Join(dataDir, "jobs")} {
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("Errore pulizia delle run locali in %s: %v", dir, err)
+			}
+		}
+	}
+	// I file di shuffle di un'esecuzione precedente non sono più referenziati,
+	// così come le run temporanee di ordinamento e merge
+	for _, dir := range []string{shuffleDir(), sortDir(), mergeDir("")} {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Errore pulizia di %s: %v", dir, err)
+		}
+	}
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		log.Fatalf("Errore creazione di %s: %v", dataDir, err)
+	}
+
 	// Invio di Register al master
-	registerSelf(*address, role, masterAddr)
+	registerSelf(*address, role, masters)
+
+	// Heartbeat periodici per la liveness
+	go sendHeartbeats(*address, role, masters)
 
 	// Crea una nuova istanza del worker che implementa i metodi RPC
 	worker := new(Worker)
@@ -65,23 +95,84 @@ func main() {
 	server.Accept(listener)
 }
 
+// Indirizzi dei master candidati: solo il leader accetta connessioni, quindi il worker
+// passa al successivo quando quello corrente non risponde
+type masterList struct {
+	mu    sync.Mutex
+	addrs []string
+	cur   int
+}
+
+func newMasterList(env string) *masterList {
+	var addrs []string
+	for _, addr := range strings.Split(env, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	return &masterList{addrs: addrs}
+}
+
+// Master a cui il worker si rivolge
+func (m *masterList) current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addrs[m.cur]
+}
+
+// Passa al master successivo (lo standby che potrebbe aver preso il controllo)
+func (m *masterList) next() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cur = (m.cur + 1) % len(m.addrs)
+}
+
+// Timeout di connessione e di chiamata verso il master: un master bloccato può accettare
+// ancora connessioni TCP senza mai rispondere
+var masterTimeout = 5 * time.Second
+
+func dialMaster(addr string) (*rpc.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, masterTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// Chiama il master con timeout; in caso di timeout il chiamante chiude il client
+func callMaster(client *rpc.Client, method string, args, reply interface{}) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(masterTimeout):
+		return fmt.Errorf("%s: nessuna risposta entro %v", method, masterTimeout)
+	}
+}
+
 // Registrazione al Master via RPC
-func registerSelf(address, role, masterAddr string) {
+func registerSelf(address, role string, masters *masterList) {
 	for {
-		client, err := rpc.Dial("tcp", masterAddr)
+		masterAddr := masters.current()
+		client, err := dialMaster(masterAddr)
 		if err != nil {
 			log.Printf("Master non raggiungibile (%s), retry tra 3s...", masterAddr)
+			masters.next()
 			time.Sleep(3 * time.Second)
 			continue
 		}
 
-		defer client.Close()
-
 		req := utils.WorkerConfig{Role: role, Address: address}
 		var reply bool
-		err = client.Call("Master.Register", req, &reply)
+		err = callMaster(client, "Master.Register", req, &reply)
+		client.Close()
 		if err != nil {
-			log.Printf("Errore RPC Register: %v, retry tra 3s...", err)
+			// Anche un master che accetta connessioni ma non risponde può essere caduto: si prova il successivo
+			log.Printf("Errore RPC Register su %s: %v, retry tra 3s...", masterAddr, err)
+			masters.next()
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -91,3 +182,42 @@ func registerSelf(address, role, masterAddr string) {
 	}
 }
 
+// Invia periodicamente un heartbeat al master; se il master non conosce più il worker si registra di nuovo
+func sendHeartbeats(address, role string, masters *masterList) {
+	interval := 1 * time.Second
+	var client *rpc.Client
+
+	for {
+		if client == nil {
+			masterAddr := masters.current()
+			c, err := dialMaster(masterAddr)
+			if err != nil {
+				log.Printf("Heartbeat: master non raggiungibile (%s): %v", masterAddr, err)
+				masters.next()
+				time.Sleep(interval)
+				continue
+			}
+			client = c
+		}
+
+		req := utils.HeartbeatRequest{Address: address, Role: role}
+		var reply utils.HeartbeatReply
+		if err := callMaster(client, "Master.Heartbeat", req, &reply); err != nil {
+			log.Printf("Heartbeat fallito su %s: %v", masters.current(), err)
+			client.Close()
+			client = nil
+			masters.next()
+			time.Sleep(interval)
+			continue
+		}
+
+		if !reply.Registered {
+			log.Println("Heartbeat: il master non conosce questo worker, nuova registrazione")
+			registerSelf(address, role, masters)
+		}
+		if reply.IntervalMs > 0 {
+			interval = time.Duration(reply.IntervalMs) * time.Millisecond
+		}
+		time.Sleep(interval)
+	}
+}